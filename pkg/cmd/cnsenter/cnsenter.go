@@ -1,10 +1,18 @@
+//go:build linux
+
 package cnsenter
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
 
 	"github.com/ssup2/kpexec/pkg/crictl"
 	"github.com/ssup2/kpexec/pkg/nsenter"
@@ -15,6 +23,12 @@ const (
 	OptRuntimeCrio       = "cri-o"
 	OptRuntimeDocker     = "docker"
 
+	OptDefaultPIDFile = "/tmp/cnsenter.pid"
+
+	hostInitPID  = 1
+	hostInitRoot = "/proc/1/root"
+	hostInitWd   = "/"
+
 	cnsenterExample = `
 		# Run date command in containerd container's all namespaces.
 		cnsenter -r containerd -c [CONTAINER ID] -a date
@@ -27,11 +41,35 @@ const (
 
 		# Set CRI socket path / containerd socket path
 		cnsenter -c [CONTAINER ID] --cri [CRI SOCKET PATH / CONTAINERD SOCKET PATH] -a date
+
+		# Set containerd namespace and state dir of containerd running with custom --state
+		cnsenter -c [CONTAINER ID] --containerd-namespace default --containerd-state /data/containerd/state -a date
+
+		# Run bash command in host's all namespaces of PID 1
+		cnsenter --host -a -- bash -il
+
+		# Run bash command in network, IPC and UTS namespaces of the pod sandbox
+		cnsenter -r containerd --sandbox [POD UID] -n -i -u -- bash -il
+
+		# Run bash command with the stopped container's snapshot mounted read-only at /croot
+		cnsenter -r containerd -c [CONTAINER ID] --snapshot /croot -- bash -il
+
+		# Test with fake runtime whose containers and pod sandboxes are described in fixture JSON
+		cnsenter -r fake --cri [FIXTURE JSON PATH] -c [CONTAINER ID] -a date
+
+		# Send SIGINT to the command run by cnsenter
+		cnsenter --kill SIGINT
 		`
 )
 
 var (
 	version = "latest"
+
+	// Host's PID 1 doesn't have envs for shells, so set default envs
+	hostDefaultEnvs = []string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOME=/root",
+	}
 )
 
 // Cmd
@@ -39,7 +77,7 @@ func New() *cobra.Command {
 	options := &Options{}
 
 	cmd := &cobra.Command{
-		Use:                   "cnsenter -c [CONTAINER ID] [flags] -- COMMAND [args...]",
+		Use:                   "cnsenter -c [CONTAINER ID] | --host | --sandbox [POD UID] [flags] -- COMMAND [args...]",
 		DisableFlagsInUseLine: true,
 		Short:                 "Execute a command in a container through the CRI",
 		Long:                  "Execute a command in a container through the CRI",
@@ -47,18 +85,34 @@ func New() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if options.version {
 				fmt.Printf("version: %s\n", version)
+			} else if options.kill != "" {
+				if err := options.Kill(); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to send signal : %+v\n", err)
+					os.Exit(1)
+				}
 			} else {
 				if err := options.Run(args); err != nil {
-					fmt.Printf("failed to run cnsenter : %+v\n", err)
+					// Exit with the command's exit code
+					var exitErr *ExitError
+					if errors.As(err, &exitErr) {
+						os.Exit(exitErr.ExitCode())
+					}
+
+					fmt.Fprintf(os.Stderr, "failed to run cnsenter : %+v\n", err)
 					os.Exit(1)
 				}
 			}
 		},
 	}
 
-	cmd.Flags().StringVarP(&options.contRuntime, "runtime", "r", OptRuntimeContainerd, "container runtime")
+	cmd.Flags().StringVarP(&options.contRuntime, "runtime", "r", OptRuntimeContainerd, fmt.Sprintf("container runtime (%s)", strings.Join(crictl.Runtimes(), ", ")))
 	cmd.Flags().StringVarP(&options.contID, "container", "c", "", "container ID to enter")
 	cmd.Flags().StringVarP(&options.criSocket, "cri", "", "", "CRI socket path")
+	cmd.Flags().StringVarP(&options.contdNamespace, "containerd-namespace", "", "", "containerd namespace of the container (default: all namespaces for containerd, moby for docker)")
+	cmd.Flags().StringVarP(&options.contdStatePath, "containerd-state", "", "", "containerd state dir set by containerd's --state (default: detected)")
+	cmd.Flags().BoolVarP(&options.host, "host", "", false, "enter host namespaces of PID 1 instead of container")
+	cmd.Flags().StringVarP(&options.sandboxPodUID, "sandbox", "", "", "enter namespaces of the pod sandbox of the pod UID instead of container")
+	cmd.Flags().StringVarP(&options.snapshotPath, "snapshot", "", "", "mount the container's snapshot read-only at the path and run the command without entering namespaces")
 
 	cmd.Flags().BoolVarP(&options.nsAll, "all", "a", false, "enter all container namespace")
 	cmd.Flags().BoolVarP(&options.nsMount, "mount", "m", false, "enter container mount namespace")
@@ -77,6 +131,10 @@ func New() *cobra.Command {
 	cmd.Flags().IntVarP(&options.gid, "setgid", "G", 0, "set gid in entered namespace")
 
 	cmd.Flags().StringArrayVarP(&options.envs, "env", "e", nil, "set a additional environment")
+	cmd.Flags().BoolVarP(&options.stdinSync, "stdin-sync", "", false, "wait for a sync byte from stdin before running the command")
+
+	cmd.Flags().StringVarP(&options.pidFile, "pid-file", "", OptDefaultPIDFile, "cnsenter's PID file")
+	cmd.Flags().StringVarP(&options.kill, "kill", "", "", "send the signal (ex. SIGINT) to the command run by cnsenter of the PID file")
 
 	cmd.Flags().BoolVarP(&options.version, "version", "v", false, "Show version")
 
@@ -88,6 +146,13 @@ type Options struct {
 	contRuntime string
 	contID      string
 	criSocket   string
+	host        bool
+
+	contdNamespace string
+	contdStatePath string
+
+	sandboxPodUID string
+	snapshotPath  string
 
 	nsAll    bool
 	nsMount  bool
@@ -107,6 +172,11 @@ type Options struct {
 
 	envs []string
 
+	stdinSync bool
+
+	pidFile string
+	kill    string
+
 	version bool
 }
 
@@ -115,40 +185,161 @@ func (o *Options) Run(args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("you must specify at least one command for the container")
 	}
-	if len(o.contID) == 0 {
+	targets := 0
+	for _, set := range []bool{len(o.contID) != 0, o.host, len(o.sandboxPodUID) != 0} {
+		if set {
+			targets++
+		}
+	}
+	if targets == 0 {
 		return fmt.Errorf("container name must be specified")
+	} else if targets > 1 {
+		return fmt.Errorf("only one of container, host and sandbox can be specified")
+	} else if o.snapshotPath != "" && len(o.contID) == 0 {
+		return fmt.Errorf("container must be specified with snapshot")
 	}
 
-	// Get container infos via crictl
-	cri, err := crictl.New(o.contRuntime)
+	// Wait for the sync byte
+	// Read only one byte not to consume the command's stdin
+	if o.stdinSync {
+		syncByte := make([]byte, 1)
+		if _, err := os.Stdin.Read(syncByte); err != nil {
+			return fmt.Errorf("failed to read the sync byte from stdin : %+v", err)
+		}
+	}
+
+	// Get the command which runs in the snapshot or enters the target's namespaces
+	var cmd *exec.Cmd
+	var contEnvs []string
+	var err error
+	if o.snapshotPath != "" {
+		cmd, contEnvs, err = o.getSnapshotCmd(args)
+	} else {
+		cmd, contEnvs, err = o.getNsenterCmd(args)
+	}
 	if err != nil {
 		return err
 	}
-	if o.criSocket != "" {
-		cri.SetSocketPath(o.criSocket)
+
+	// Append envs
+	for _, env := range o.envs {
+		contEnvs = append(contEnvs, env)
 	}
 
-	contPID, err := cri.GetInitPid(o.contID)
-	if err != nil {
-		return err
+	// Write PID file to receive signals
+	if o.pidFile != "" {
+		if err := writePIDFile(o.pidFile); err != nil {
+			return err
+		}
+		defer os.Remove(o.pidFile)
 	}
-	contRoot, err := cri.GetRootPath(o.contID)
-	if err != nil {
+
+	// Set subreaper to reap orphaned descendants
+	if err := setChildSubreaper(); err != nil {
 		return err
 	}
-	contWorkingDir, err := cri.GetCWDPath(o.contID)
-	if err != nil {
+
+	// Receive signals before starting the command. Signals received before the command starts are relayed
+	// after it starts instead of killing cnsenter, which isn't PID 1 in host PID namespace
+	sigs := make(chan os.Signal, len(relaySignals))
+	signal.Notify(sigs, relaySignals...)
+	defer signal.Stop(sigs)
+
+	// Run the command
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	cmd.Env = contEnvs
+	if err := cmd.Start(); err != nil {
 		return err
 	}
-	contEnvs, err := cri.GetEnvs(o.contID)
-	if err != nil {
-		return err
+
+	// Relay signals to the command
+	go func() {
+		for sig := range sigs {
+			if err := relaySignal(cmd.Process.Pid, sig.(syscall.Signal)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to relay signal %s : %+v\n", sig, err)
+			}
+		}
+	}()
+
+	// Wait the command and reap zombies
+	var status syscall.WaitStatus
+	for {
+		var wstatus syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &wstatus, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if pid == cmd.Process.Pid {
+			status = wstatus
+			break
+		}
+	}
+
+	if !status.Exited() || status.ExitStatus() != 0 {
+		return &ExitError{Status: status}
+	}
+	return nil
+}
+
+// getNsenterCmd returns nsenter command which enters the target's namespaces and the target's envs
+func (o *Options) getNsenterCmd(args []string) (*exec.Cmd, []string, error) {
+	// Get container infos via CRI
+	// In host mode, use host's PID 1 instead of container
+	var contPID uint64
+	var contRoot, contWorkingDir string
+	var contEnvs []string
+	if o.host {
+		contPID = hostInitPID
+		contRoot = hostInitRoot
+		contWorkingDir = hostInitWd
+		contEnvs = append([]string{}, hostDefaultEnvs...)
+	} else if o.sandboxPodUID != "" {
+		// Sandbox (pause) process doesn't have a root and envs for debugging,
+		// so only its namespaces are used with host's defaults
+		cri, err := o.newRuntime()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sandboxID, err := cri.GetSandboxID(o.sandboxPodUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		contPID, err = cri.GetSandboxInitPid(sandboxID)
+		if err != nil {
+			return nil, nil, err
+		}
+		contRoot = hostInitRoot
+		contWorkingDir = hostInitWd
+		contEnvs = append([]string{}, hostDefaultEnvs...)
+	} else {
+		cri, err := o.newRuntime()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		contInfo, err := cri.GetContainerInfo(o.contID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if contInfo.PID == 0 {
+			return nil, nil, fmt.Errorf("container %s is not running", o.contID)
+		}
+		contPID = contInfo.PID
+		contRoot = contInfo.RootPath
+		contWorkingDir = contInfo.CWDPath
+		contEnvs = contInfo.Envs
 	}
 
 	// Allocate nsenter
 	nse, err := nsenter.New()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// Set PID, command
@@ -184,7 +375,7 @@ func (o *Options) Run(args []string) error {
 	// Set root and working directory
 	if o.rootSymbolic != "" {
 		if err := os.Symlink(contRoot, o.rootSymbolic); err != nil {
-			return err
+			return nil, nil, err
 		}
 	}
 	if o.workingDir {
@@ -205,20 +396,84 @@ func (o *Options) Run(args []string) error {
 		nse.SetOptGid(o.gid)
 	}
 
-	// Append envs
-	for _, env := range o.envs {
-		contEnvs = append(contEnvs, env)
+	return nse.GetExecCmd(), contEnvs, nil
+}
+
+// getSnapshotCmd mounts the container's snapshot read-only and returns the command which runs in cnsenter's
+// namespaces with cnsenter's envs. The snapshot of the stopped container can be mounted
+func (o *Options) getSnapshotCmd(args []string) (*exec.Cmd, []string, error) {
+	cri, err := o.newRuntime()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Run nsenter
-	cmd := nse.GetExecCmd()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Env = contEnvs
-	if err := cmd.Run(); err != nil {
+	mounts, err := cri.GetSnapshotMounts(o.contID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := mountSnapshot(mounts, hostInitRoot, o.snapshotPath); err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = o.snapshotPath
+	return cmd, append(os.Environ(), "PWD="+o.snapshotPath), nil
+}
+
+// newRuntime returns the container runtime with the socket path and containerd's settings set by options
+func (o *Options) newRuntime() (crictl.Runtime, error) {
+	cri, err := crictl.New(o.contRuntime)
+	if err != nil {
+		return nil, err
+	}
+	if o.criSocket != "" {
+		if err := cri.SetSocketPath(o.criSocket); err != nil {
+			return nil, err
+		}
+	}
+	if o.contdNamespace != "" || o.contdStatePath != "" {
+		contd, ok := cri.(crictl.ContainerdRuntime)
+		if !ok {
+			return nil, fmt.Errorf("%s runtime doesn't use containerd", o.contRuntime)
+		}
+		if o.contdNamespace != "" {
+			contd.SetContainerdNamespace(o.contdNamespace)
+		}
+		if o.contdStatePath != "" {
+			contd.SetContainerdStatePath(o.contdStatePath)
+		}
+	}
+	return cri, nil
+}
+
+func (o *Options) Kill() error {
+	// Get signal
+	sig := unix.SignalNum("SIG" + strings.TrimPrefix(strings.ToUpper(o.kill), "SIG"))
+	if sig == 0 {
+		return fmt.Errorf("%s is not supported signal", o.kill)
+	}
+
+	// Send signal to cnsenter and cnsenter relays it to the command
+	pid, err := readPIDFile(o.pidFile)
+	if err != nil {
 		return err
 	}
+	return syscall.Kill(pid, sig)
+}
 
-	return nil
+// ExitError
+type ExitError struct {
+	Status syscall.WaitStatus
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.ExitCode())
+}
+
+func (e *ExitError) ExitCode() int {
+	// If the command is killed by a signal, follow the shell's convention (128 + signal number)
+	if e.Status.Signaled() {
+		return 128 + int(e.Status.Signal())
+	}
+	return e.Status.ExitStatus()
 }
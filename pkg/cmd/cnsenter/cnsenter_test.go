@@ -0,0 +1,213 @@
+//go:build linux
+
+package cnsenter
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testFixture = `{
+	"containers": {
+		"cont1": {"pid": 4321, "rootPath": "/rootfs", "cwdPath": "/app", "envs": ["PATH=/usr/bin:/bin", "APP=app"]},
+		"stopped": {"rootPath": "/rootfs"}
+	},
+	"sandboxes": {
+		"uid1": {"id": "sandbox1", "pid": 99}
+	}
+}`
+
+// setupFakeRuntime writes fake runtime's fixture and stub nsenter which records its args and envs
+func setupFakeRuntime(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	fixturePath := filepath.Join(dir, "fixture.json")
+	if err := os.WriteFile(fixturePath, []byte(testFixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	binDir := filepath.Join(dir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stub := "#!/bin/sh\necho \"$@\" > " + dir + "/args\necho \"$APP $EXTRA\" > " + dir + "/envs\nexit 3\n"
+	if err := os.WriteFile(filepath.Join(binDir, "nsenter"), []byte(stub), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+":"+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+	return dir, fixturePath
+}
+
+func TestRunWithFakeRuntime(t *testing.T) {
+	dir, fixturePath := setupFakeRuntime(t)
+	tests := []struct {
+		options *Options
+		args    string
+		envs    string
+	}{
+		{
+			&Options{contID: "cont1", nsAll: true, workingDir: true, envs: []string{"EXTRA=extra"}},
+			"--target=4321 --all --wd -- date", "app extra",
+		},
+		{
+			&Options{contID: "cont1", nsPID: true, workingDir: true, workingDirBase: "/croot"},
+			"--target=4321 --pid --wd=/croot/app -- date", "app",
+		},
+		{
+			&Options{sandboxPodUID: "uid1", nsNet: true, nsIPC: true},
+			"--target=99 --ipc --net -- date", "",
+		},
+	}
+
+	for _, test := range tests {
+		test.options.contRuntime = "fake"
+		test.options.criSocket = fixturePath
+		test.options.pidFile = filepath.Join(dir, "cnsenter.pid")
+
+		// Check the exit code of the command is passed
+		err := test.options.Run([]string{"date"})
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+			t.Fatalf("error %v is not expected", err)
+		}
+
+		// Check nsenter's args and envs
+		args, _ := os.ReadFile(filepath.Join(dir, "args"))
+		envs, _ := os.ReadFile(filepath.Join(dir, "envs"))
+		if strings.TrimSpace(string(args)) != test.args || strings.TrimSpace(string(envs)) != test.envs {
+			t.Fatalf("nsenter's args %q and envs %q are not expected", args, envs)
+		}
+	}
+
+	// Stopped and unknown containers can't be entered
+	for _, contID := range []string{"stopped", "unknown"} {
+		o := &Options{contRuntime: "fake", criSocket: fixturePath, contID: contID}
+		if err := o.Run([]string{"date"}); err == nil {
+			t.Fatalf("container %s is entered", contID)
+		}
+	}
+}
+
+func TestNewRuntimeWithContainerdSettings(t *testing.T) {
+	// Only runtimes using containerd accept containerd's settings
+	o := &Options{contRuntime: "fake", contdNamespace: "default"}
+	if _, err := o.newRuntime(); err == nil {
+		t.Fatalf("containerd namespace is allowed for fake runtime")
+	}
+	o = &Options{contRuntime: OptRuntimeContainerd, contdNamespace: "default", contdStatePath: "/data/containerd/state"}
+	if _, err := o.newRuntime(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExitErrorExitCode(t *testing.T) {
+	tests := []struct {
+		cmd  []string
+		code int
+	}{
+		{[]string{"sh", "-c", "exit 3"}, 3},
+		{[]string{"sh", "-c", "kill -TERM $$"}, 143},
+		{[]string{"sh", "-c", "kill -KILL $$"}, 137},
+	}
+
+	for _, test := range tests {
+		// Run command
+		cmd := exec.Command(test.cmd[0], test.cmd[1:]...)
+		cmd.Run()
+
+		// Check exit code
+		exitErr := &ExitError{Status: cmd.ProcessState.Sys().(syscall.WaitStatus)}
+		if code := exitErr.ExitCode(); code != test.code {
+			t.Fatalf("exit code %d is not expected %d", code, test.code)
+		}
+	}
+}
+
+func TestRelaySignal(t *testing.T) {
+	// Run parent process which doesn't relay signals
+	cmd := exec.Command("sh", "-c", "sleep 10 & wait $!")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// Relay signal to child process
+	if err := relaySignal(cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the parent exits normally by the child's termination
+	done := make(chan error)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+		if !cmd.ProcessState.Exited() || cmd.ProcessState.ExitCode() != 143 {
+			t.Fatalf("signal is not relayed to the child process : %v", cmd.ProcessState)
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatalf("signal is not relayed to the child process")
+	}
+}
+
+func TestRunWithStdinSync(t *testing.T) {
+	dir, fixturePath := setupFakeRuntime(t)
+
+	// Stub nsenter records its stdin and writes to stdout and stderr separately
+	stub := "#!/bin/sh\ncat > " + dir + "/stdin\necho out\necho err >&2\n"
+	if err := os.WriteFile(filepath.Join(dir, "bin", "nsenter"), []byte(stub), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace stdin, stdout and stderr with files
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdin, stdout, stderr *os.File) { os.Stdin, os.Stdout, os.Stderr = stdin, stdout, stderr }(os.Stdin, os.Stdout, os.Stderr)
+	os.Stdin, os.Stdout, os.Stderr = stdinReader, stdout, stderr
+
+	o := &Options{contRuntime: "fake", criSocket: fixturePath, contID: "cont1", nsAll: true, stdinSync: true,
+		pidFile: filepath.Join(dir, "cnsenter.pid")}
+	done := make(chan error)
+	go func() { done <- o.Run([]string{"cat"}) }()
+
+	// The command doesn't start before the sync byte
+	time.Sleep(300 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(dir, "stdin")); !os.IsNotExist(err) {
+		t.Fatalf("command started before the sync byte : %v", err)
+	}
+
+	// The command gets stdin after the sync byte
+	stdinWriter.Write([]byte{0})
+	stdinWriter.Write([]byte("input"))
+	stdinWriter.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("command isn't finished")
+	}
+	for name, expected := range map[string]string{"stdin": "input", "stdout": "out\n", "stderr": "err\n"} {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != expected {
+			t.Fatalf("%s %q is not expected", name, data)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package cnsenter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var (
+	relaySignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP,
+		syscall.SIGUSR1, syscall.SIGUSR2}
+)
+
+// relaySignal sends the signal to the process nsenter started.
+// nsenter forks the command to enter PID namespace and doesn't relay signals to it,
+// so send the signal to nsenter's children. If nsenter doesn't fork, send it to nsenter.
+func relaySignal(nsenterPID int, sig syscall.Signal) error {
+	childPIDs, err := getChildPIDs(nsenterPID)
+	if err != nil || len(childPIDs) == 0 {
+		return syscall.Kill(nsenterPID, sig)
+	}
+
+	for _, childPID := range childPIDs {
+		if err := syscall.Kill(childPID, sig); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
+func getChildPIDs(pid int) ([]int, error) {
+	statPaths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	var childPIDs []int
+	for _, statPath := range statPaths {
+		// Process can exit while reading its stat
+		stat, err := os.ReadFile(statPath)
+		if err != nil {
+			continue
+		}
+
+		// Parse parent PID. stat format is "pid (comm) state ppid ..." and comm can have spaces
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil || ppid != pid {
+			continue
+		}
+
+		childPID, err := strconv.Atoi(filepath.Base(filepath.Dir(statPath)))
+		if err != nil {
+			continue
+		}
+		childPIDs = append(childPIDs, childPID)
+	}
+	return childPIDs, nil
+}
+
+func writePIDFile(path string) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0644)
+}
+
+func readPIDFile(path string) (int, error) {
+	pidBytes, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if err != nil {
+		return 0, fmt.Errorf("wrong PID file %s : %+v", path, err)
+	}
+	return pid, nil
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package cnsenter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ssup2/kpexec/pkg/crictl"
+)
+
+// readOnlyMount is a read-only mount of container's snapshot accessed through host's root
+type readOnlyMount struct {
+	fsType string
+	source string
+	data   string
+	bind   bool
+}
+
+// getReadOnlyMount converts the snapshot's mount to read-only mount. Overlay's upper dir becomes the top lower dir,
+// so the snapshot isn't changed by the mount and the work dir isn't used
+func getReadOnlyMount(m crictl.Mount, hostRoot string) (*readOnlyMount, error) {
+	switch m.Type {
+	case "bind", "rbind":
+		return &readOnlyMount{source: hostRoot + m.Source, bind: true}, nil
+	case "overlay":
+		var upperDir string
+		var lowerDirs, opts []string
+		for _, opt := range m.Options {
+			switch {
+			case strings.HasPrefix(opt, "upperdir="):
+				upperDir = strings.TrimPrefix(opt, "upperdir=")
+			case strings.HasPrefix(opt, "lowerdir="):
+				for _, dir := range strings.Split(strings.TrimPrefix(opt, "lowerdir="), ":") {
+					if dir != "" {
+						lowerDirs = append(lowerDirs, dir)
+					}
+				}
+			case strings.HasPrefix(opt, "workdir="), opt == "rw", opt == "ro":
+			default:
+				opts = append(opts, opt)
+			}
+		}
+		if upperDir != "" {
+			lowerDirs = append([]string{upperDir}, lowerDirs...)
+		}
+		if len(lowerDirs) == 0 {
+			return nil, fmt.Errorf("overlay mount doesn't have any layer")
+		}
+		for i := range lowerDirs {
+			lowerDirs[i] = hostRoot + lowerDirs[i]
+		}
+
+		// Overlay needs at least two lower dirs without upper dir
+		if len(lowerDirs) == 1 {
+			return &readOnlyMount{source: lowerDirs[0], bind: true}, nil
+		}
+		opts = append([]string{"lowerdir=" + strings.Join(lowerDirs, ":")}, opts...)
+		return &readOnlyMount{fsType: "overlay", source: "overlay", data: strings.Join(opts, ",")}, nil
+	}
+	return nil, fmt.Errorf("%s is not supported snapshot mount type", m.Type)
+}
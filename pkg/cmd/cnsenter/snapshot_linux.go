@@ -0,0 +1,38 @@
+package cnsenter
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/ssup2/kpexec/pkg/crictl"
+)
+
+// mountSnapshot mounts container's snapshot read-only at the target path
+func mountSnapshot(mounts []crictl.Mount, hostRoot, target string) error {
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	for _, m := range mounts {
+		roMount, err := getReadOnlyMount(m, hostRoot)
+		if err != nil {
+			return err
+		}
+		if !roMount.bind {
+			if err := unix.Mount(roMount.source, target, roMount.fsType, unix.MS_RDONLY, roMount.data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Read-only flag is ignored at bind mount, so remount it
+		if err := unix.Mount(roMount.source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return err
+		}
+		if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
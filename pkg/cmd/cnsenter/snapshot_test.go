@@ -0,0 +1,48 @@
+//go:build linux
+
+package cnsenter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ssup2/kpexec/pkg/crictl"
+)
+
+func TestGetReadOnlyMount(t *testing.T) {
+	tests := []struct {
+		mount    crictl.Mount
+		expected *readOnlyMount
+	}{
+		// Upper dir becomes the top lower dir and work dir is dropped
+		{
+			crictl.Mount{Type: "overlay", Source: "overlay",
+				Options: []string{"index=off", "workdir=/s/2/work", "upperdir=/s/2/fs", "lowerdir=/s/1/fs"}},
+			&readOnlyMount{fsType: "overlay", source: "overlay", data: "lowerdir=/proc/1/root/s/2/fs:/proc/1/root/s/1/fs,index=off"},
+		},
+		// Overlay without lower dirs is bind mounted
+		{
+			crictl.Mount{Type: "overlay", Source: "overlay", Options: []string{"lowerdir=", "upperdir=/l/1/diff", "workdir=/l/1/work"}},
+			&readOnlyMount{source: "/proc/1/root/l/1/diff", bind: true},
+		},
+		{
+			crictl.Mount{Type: "bind", Source: "/s/1/fs", Options: []string{"rbind", "rw"}},
+			&readOnlyMount{source: "/proc/1/root/s/1/fs", bind: true},
+		},
+	}
+
+	for _, test := range tests {
+		roMount, err := getReadOnlyMount(test.mount, hostInitRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(roMount, test.expected) {
+			t.Fatalf("mount %+v is not expected %+v", roMount, test.expected)
+		}
+	}
+
+	// Unknown mount type
+	if _, err := getReadOnlyMount(crictl.Mount{Type: "zfs"}, hostInitRoot); err == nil {
+		t.Fatalf("zfs mount is not supported")
+	}
+}
@@ -0,0 +1,10 @@
+package cnsenter
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setChildSubreaper makes orphaned descendants reparent to cnsenter, so cnsenter can reap them
+func setChildSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
@@ -0,0 +1,113 @@
+package kpexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+func attachPod(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, podNs, podName, contName string,
+	tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+	// Set attach request
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(podNs).
+		Name(podName).
+		SubResource("attach").
+		VersionedParams(&corev1.PodAttachOptions{
+			Container: contName,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    !tty,
+			TTY:       tty,
+		}, scheme.ParameterCodec)
+
+	// Get executor
+	exec, err := newExecutor(restConfig, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to get attach executor : %+v", err)
+	}
+
+	// Set stream options
+	streamOpts := remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Tty:    tty,
+	}
+	if !tty {
+		streamOpts.Stderr = stderr
+	}
+
+	// Switch to raw terminal mode if stdin is terminal
+	if tty && term.IsTerminal(int(os.Stdin.Fd())) {
+		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return fmt.Errorf("failed to set raw terminal mode : %+v", err)
+		}
+		defer term.Restore(int(os.Stdin.Fd()), oldState)
+	}
+
+	// Send terminal size and its changes
+	if tty && term.IsTerminal(int(os.Stdout.Fd())) {
+		sizeQueue := newTermSizeQueue(int(os.Stdout.Fd()))
+		defer sizeQueue.Stop()
+		streamOpts.TerminalSizeQueue = sizeQueue
+	}
+
+	// Attach
+	return exec.StreamWithContext(ctx, streamOpts)
+}
+
+func execPod(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, podNs, podName, contName string, cmd []string) error {
+	// Set exec request
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(podNs).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: contName,
+			Command:   cmd,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	// Get executor
+	exec, err := newExecutor(restConfig, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to get exec executor : %+v", err)
+	}
+
+	// Exec and return stderr with error
+	var stdout, stderr bytes.Buffer
+	if err := exec.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return fmt.Errorf("%w : %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// newExecutor gets the executor streaming over WebSocket. If API server or proxies don't upgrade the request to
+// WebSocket, it falls back to SPDY
+func newExecutor(restConfig *rest.Config, reqURL *url.URL) (remotecommand.Executor, error) {
+	spdyExec, err := remotecommand.NewSPDYExecutor(restConfig, "POST", reqURL)
+	if err != nil {
+		return nil, err
+	}
+	websocketExec, err := remotecommand.NewWebSocketExecutor(restConfig, "GET", reqURL.String())
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocketExec, spdyExec, httpstream.IsUpgradeFailure)
+}
@@ -0,0 +1,18 @@
+package kpexec
+
+import (
+	"net/url"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestNewExecutor(t *testing.T) {
+	reqURL, err := url.Parse("https://127.0.0.1:6443/api/v1/namespaces/default/pods/cnsenter-test/attach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec, err := newExecutor(&rest.Config{Host: "https://127.0.0.1:6443"}, reqURL); err != nil || exec == nil {
+		t.Fatalf("executor %v is not expected : %v", exec, err)
+	}
+}
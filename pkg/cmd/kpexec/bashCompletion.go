@@ -65,7 +65,7 @@ __kubectl_get_resource_pod()
 __kubectl_get_containers()
 {
     local template
-    template="{{ range .spec.initContainers }}{{ .name }} {{end}}{{ range .spec.containers  }}{{ .name }} {{ end }}"
+    template="{{ range .spec.initContainers }}{{ .name }} {{end}}{{ range .spec.containers  }}{{ .name }} {{ end }}{{ range .spec.ephemeralContainers }}{{ .name }} {{ end }}"
     __kpexec_debug "${FUNCNAME} nouns are ${nouns[*]}"
     local len="${#nouns[@]}"
     if [[ ${len} -ne 1 ]]; then
@@ -0,0 +1,33 @@
+package kpexec
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newClientConfig gets client config from kubeconfig path and override flags.
+// If kubeconfig path isn't set, kubeconfig is got from KUBECONFIG env or default path (~/.kube/config)
+func (o *Options) newClientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &o.configOverrides)
+}
+
+func newRestConfig(clientConfig clientcmd.ClientConfig) (*rest.Config, error) {
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rest config from kubeconfig : %+v", err)
+	}
+	return restConfig, nil
+}
+
+func getNamespace(clientConfig clientcmd.ClientConfig) (string, error) {
+	// Client config returns default namespace if namespace isn't set in the context
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return "", fmt.Errorf("failed to get namespace from kubeconfig : %+v", err)
+	}
+	return namespace, nil
+}
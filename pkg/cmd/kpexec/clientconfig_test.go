@@ -0,0 +1,67 @@
+package kpexec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+users:
+- name: admin
+  user:
+    token: admin-token
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: admin
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+    namespace: prod-ns
+`
+
+func TestNewClientConfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Current context without namespace
+	o := &Options{kubeconfig: kubeconfig}
+	restConfig, err := newRestConfig(o.newClientConfig())
+	if err != nil || restConfig.Host != "https://dev.example.com" {
+		t.Fatalf("rest config %v, err %v is not expected", restConfig, err)
+	}
+	if namespace, err := getNamespace(o.newClientConfig()); err != nil || namespace != "default" {
+		t.Fatalf("namespace %s, err %v is not expected", namespace, err)
+	}
+
+	// Override context and impersonate
+	o.configOverrides.CurrentContext = "prod"
+	o.configOverrides.AuthInfo.Impersonate = "jane"
+	o.configOverrides.AuthInfo.ImpersonateGroups = []string{"devs"}
+	o.configOverrides.Timeout = "5s"
+	restConfig, err = newRestConfig(o.newClientConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restConfig.Host != "https://prod.example.com" || restConfig.Impersonate.UserName != "jane" ||
+		len(restConfig.Impersonate.Groups) != 1 || restConfig.Timeout.Seconds() != 5 {
+		t.Fatalf("rest config %v is not expected", restConfig)
+	}
+	if namespace, err := getNamespace(o.newClientConfig()); err != nil || namespace != "prod-ns" {
+		t.Fatalf("namespace %s, err %v is not expected", namespace, err)
+	}
+}
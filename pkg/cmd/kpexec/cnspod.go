@@ -0,0 +1,400 @@
+package kpexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	dryRunNone   = "none"
+	dryRunClient = "client"
+	dryRunServer = "server"
+
+	outputYAML = "yaml"
+)
+
+// buildCnsPod builds cnsenter pod which runs the command in the target container.
+// In tools mode, the runtime's state path set by option or of the target node's distribution is mounted
+func (o *Options) buildCnsPod(tPod *corev1.Pod, tNode *corev1.Node, tContRuntime, tContID string, tPodCmd []string) (*corev1.Pod, error) {
+	cnsPod := o.newCnsPod(tPod.Spec.NodeName)
+	cnsContRootVolumeType := corev1.HostPathDirectory
+	cnsContdRootVolumeType := corev1.HostPathDirectoryOrCreate
+	cnsEnvs := o.getCnsEnvs()
+
+	if o.tools {
+		// For tools mode
+		// Use tools image
+		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultToolsImg, strings.TrimPrefix(version, "v"))
+
+		// Set command
+		// Do not enter mount namespace
+		// Create new mount namespace and remount procfs
+		cnsPodCmd := []string{"cnsenter", "--runtime", tContRuntime, "--container", tContID,
+			"--pid", "--net", "--ipc", "--uts", "--root-symlink", cnsContDefaultToolsRoot,
+			"--wd", "--wd-base", cnsContDefaultToolsRoot}
+		for _, env := range cnsEnvs {
+			cnsPodCmd = append(cnsPodCmd, "--env", env)
+		}
+		if o.criSocket != "" {
+			cnsPodCmd = append(cnsPodCmd, "--cri", o.criSocket)
+		}
+		// State path set by option wins, and then containerd's socket set by option like cnsenter detects it.
+		// Pass the mounted state path to cnsenter, so both sides use the same path
+		contRootContdNodePath := o.contdStatePath
+		if tContRuntime == contRuntimeContD {
+			if contRootContdNodePath == "" && o.criSocket != "" {
+				contRootContdNodePath = getContdRootPathOfSocket(o.criSocket)
+			} else if contRootContdNodePath == "" {
+				contRootContdNodePath = getContdRootPath(tNode)
+			}
+			cnsPodCmd = append(cnsPodCmd, "--containerd-state", contRootContdNodePath)
+		}
+		if !o.tty {
+			cnsPodCmd = append(cnsPodCmd, "--stdin-sync")
+		}
+		cnsPodCmd = append(cnsPodCmd, "--", "unshare", "--mount", cnsContProcRemountExec)
+		cnsPodCmd = append(cnsPodCmd, tPodCmd...)
+		cnsPod.Spec.Containers[0].Command = cnsPodCmd
+
+		// Copy DNS settings from target pod
+		cnsPod.Spec.DNSPolicy = tPod.Spec.DeepCopy().DNSPolicy
+		cnsPod.Spec.DNSConfig = tPod.Spec.DeepCopy().DNSConfig
+
+		// Set volume to access
+		if tContRuntime == contRuntimeContD {
+			// The state path may be detected wrongly, so don't fail to create cnsenter pod with the path
+			cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
+				corev1.Volume{
+					Name: contRootContdVolume,
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Type: &cnsContdRootVolumeType,
+							Path: contRootContdNodePath,
+						},
+					},
+				})
+
+			cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{
+					Name:      contRootContdVolume,
+					MountPath: contRootContdNodePath,
+				})
+		} else if tContRuntime == contRuntimeCrio {
+			cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
+				corev1.Volume{
+					Name: contRootCrioVolume,
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Type: &cnsContRootVolumeType,
+							Path: contRootCrioPath,
+						},
+					},
+				})
+
+			cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{
+					Name:      contRootCrioVolume,
+					MountPath: contRootCrioPath,
+				})
+		} else if tContRuntime == contRuntimeDocker {
+			cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
+				corev1.Volume{
+					Name: contRootDockerVolume,
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Type: &cnsContRootVolumeType,
+							Path: contRootDockerPath,
+						},
+					},
+				})
+
+			cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{
+					Name:      contRootDockerVolume,
+					MountPath: contRootDockerPath,
+				})
+		} else {
+			return nil, fmt.Errorf("%s is not supported container runtime", tContRuntime)
+		}
+	} else {
+		// For default mode
+		// Use default image
+		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultImg, strings.TrimPrefix(version, "v"))
+
+		// Set command
+		cnsPodCmd := []string{"cnsenter", "--runtime", tContRuntime, "--container", tContID,
+			"--mount", "--pid", "--net", "--ipc", "--uts", "--wd"}
+		for _, env := range cnsEnvs {
+			cnsPodCmd = append(cnsPodCmd, "--env", env)
+		}
+		if o.criSocket != "" {
+			cnsPodCmd = append(cnsPodCmd, "--cri", o.criSocket)
+		}
+		if !o.tty {
+			cnsPodCmd = append(cnsPodCmd, "--stdin-sync")
+		}
+		cnsPodCmd = append(cnsPodCmd, "--")
+		cnsPodCmd = append(cnsPodCmd, tPodCmd...)
+		cnsPod.Spec.Containers[0].Command = cnsPodCmd
+	}
+
+	return o.completeCnsPod(cnsPod)
+}
+
+// buildNodeCnsPod builds cnsenter pod which runs the command in the namespaces of the node's PID 1.
+// In tools mode, the command runs in tools image's filesystem and the node's root is mounted at /host
+func (o *Options) buildNodeCnsPod(nodeName string, cmd []string) (*corev1.Pod, error) {
+	cnsPod := o.newCnsPod(nodeName)
+	cnsEnvs := o.getCnsEnvs()
+
+	var cnsPodCmd []string
+	if o.tools {
+		// For tools mode
+		// Use tools image and mount node's root
+		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultToolsImg, strings.TrimPrefix(version, "v"))
+		nodeRootVolumeType := corev1.HostPathDirectory
+		nodeRootPropagation := corev1.MountPropagationHostToContainer
+		cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
+			corev1.Volume{
+				Name: nodeRootVolume,
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Type: &nodeRootVolumeType,
+						Path: nodeRootPath,
+					},
+				},
+			})
+		cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
+			corev1.VolumeMount{
+				Name:             nodeRootVolume,
+				MountPath:        cnsContNodeRoot,
+				MountPropagation: &nodeRootPropagation,
+			})
+
+		// Use node's DNS settings because the command runs in node's network namespace
+		cnsPod.Spec.DNSPolicy = corev1.DNSDefault
+
+		// Set command
+		// Do not enter mount namespace
+		// Create new mount namespace and remount procfs
+		cnsPodCmd = []string{"cnsenter", "--host", "--pid", "--net", "--ipc", "--uts", "--wd", "--wd-base", cnsContNodeRoot}
+		for _, env := range cnsEnvs {
+			cnsPodCmd = append(cnsPodCmd, "--env", env)
+		}
+		if !o.tty {
+			cnsPodCmd = append(cnsPodCmd, "--stdin-sync")
+		}
+		cnsPodCmd = append(cnsPodCmd, "--", "unshare", "--mount", cnsContProcRemountExec)
+	} else {
+		// For default mode
+		// Use default image
+		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultImg, strings.TrimPrefix(version, "v"))
+
+		// Set command
+		cnsPodCmd = []string{"cnsenter", "--host", "--mount", "--pid", "--net", "--ipc", "--uts", "--wd"}
+		for _, env := range cnsEnvs {
+			cnsPodCmd = append(cnsPodCmd, "--env", env)
+		}
+		if !o.tty {
+			cnsPodCmd = append(cnsPodCmd, "--stdin-sync")
+		}
+		cnsPodCmd = append(cnsPodCmd, "--")
+	}
+	cnsPod.Spec.Containers[0].Command = append(cnsPodCmd, cmd...)
+
+	return o.completeCnsPod(cnsPod)
+}
+
+// buildSandboxCnsPod builds cnsenter pod which runs the command in network, IPC and UTS namespaces of the pod sandbox.
+// The command runs in cnsenter image's filesystem because sandbox's filesystem is pause image
+func (o *Options) buildSandboxCnsPod(tPod *corev1.Pod, tContRuntime string, tPodCmd []string) (*corev1.Pod, error) {
+	cnsPod := o.newCnsPod(tPod.Spec.NodeName)
+	cnsEnvs := o.getCnsEnvs()
+
+	// Use tools image in tools mode
+	if o.tools {
+		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultToolsImg, strings.TrimPrefix(version, "v"))
+	} else {
+		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultImg, strings.TrimPrefix(version, "v"))
+	}
+
+	// Copy DNS settings from target pod
+	cnsPod.Spec.DNSPolicy = tPod.Spec.DeepCopy().DNSPolicy
+	cnsPod.Spec.DNSConfig = tPod.Spec.DeepCopy().DNSConfig
+
+	// Set command
+	cnsPodCmd := []string{"cnsenter", "--runtime", tContRuntime, "--sandbox", string(tPod.UID), "--net", "--ipc", "--uts"}
+	for _, env := range cnsEnvs {
+		cnsPodCmd = append(cnsPodCmd, "--env", env)
+	}
+	if o.criSocket != "" {
+		cnsPodCmd = append(cnsPodCmd, "--cri", o.criSocket)
+	}
+	if !o.tty {
+		cnsPodCmd = append(cnsPodCmd, "--stdin-sync")
+	}
+	cnsPodCmd = append(cnsPodCmd, "--")
+	cnsPod.Spec.Containers[0].Command = append(cnsPodCmd, tPodCmd...)
+
+	return o.completeCnsPod(cnsPod)
+}
+
+// buildInspectFSCnsPod builds tools mode cnsenter pod which runs the command with the target container's snapshot.
+// The command doesn't enter the container's namespaces, so it works even if the container is stopped
+func (o *Options) buildInspectFSCnsPod(tPod *corev1.Pod, tContRuntime, tContID string, tPodCmd []string) (*corev1.Pod, error) {
+	cnsPod := o.newCnsPod(tPod.Spec.NodeName)
+	cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultToolsImg, strings.TrimPrefix(version, "v"))
+
+	// Set command
+	cnsPodCmd := []string{"cnsenter", "--runtime", tContRuntime, "--container", tContID,
+		"--snapshot", cnsContDefaultToolsRoot}
+	for _, env := range o.getCnsEnvs() {
+		cnsPodCmd = append(cnsPodCmd, "--env", env)
+	}
+	if o.criSocket != "" {
+		cnsPodCmd = append(cnsPodCmd, "--cri", o.criSocket)
+	}
+	if !o.tty {
+		cnsPodCmd = append(cnsPodCmd, "--stdin-sync")
+	}
+	cnsPodCmd = append(cnsPodCmd, "--")
+	cnsPod.Spec.Containers[0].Command = append(cnsPodCmd, tPodCmd...)
+
+	return o.completeCnsPod(cnsPod)
+}
+
+// newCnsPod returns privileged cnsenter pod on the node. The pod can access CRI sockets
+func (o *Options) newCnsPod(nodeName string) *corev1.Pod {
+	cnsPodName := fmt.Sprintf("cnsenter-%s", getRandomString(10))
+	cnsCRISocketVolumeType := corev1.HostPathDirectory
+	cnsPrivileged := true
+
+	cnsPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cnsPodName,
+			Namespace: o.cnsPodNamespace,
+			Labels: map[string]string{
+				cnsPodLabelKey: cnsPodLabelValue,
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+			Containers: []corev1.Container{
+				{
+					Name:  cnsContName,
+					Stdin: o.stdin,
+					TTY:   o.tty,
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      criSocketVolumeRun,
+							MountPath: criSocketPathRun,
+						},
+						{
+							Name:      criSocketVolumeVar,
+							MountPath: criSocketPathVar,
+						},
+					},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: &cnsPrivileged,
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: criSocketVolumeRun,
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Type: &cnsCRISocketVolumeType,
+							Path: criSocketPathRun,
+						},
+					},
+				},
+				{
+					Name: criSocketVolumeVar,
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Type: &cnsCRISocketVolumeType,
+							Path: criSocketPathVar,
+						},
+					},
+				},
+			},
+			Tolerations: []corev1.Toleration{
+				{
+					Operator: corev1.TolerationOpExists,
+				},
+			},
+			HostPID:       true,
+			RestartPolicy: "Never",
+		},
+	}
+	return cnsPod
+}
+
+// getCnsEnvs gets envs for the command
+func (o *Options) getCnsEnvs() []string {
+	// Forward local terminal and locale envs in TTY mode and tools mode
+	var cnsEnvs []string
+	if o.tty || o.tools {
+		var termSize *remotecommand.TerminalSize
+		if o.tty {
+			termSize = getTermSize(int(os.Stdout.Fd()))
+		}
+		cnsEnvs = getForwardEnvs(os.Environ(), termSize)
+	}
+	return mergeEnvs(cnsEnvs, o.envs)
+}
+
+// completeCnsPod sets stdin sync, image and customization to cnsenter pod
+func (o *Options) completeCnsPod(cnsPod *corev1.Pod) (*corev1.Pod, error) {
+	// Set stdin sync for non-TTY mode
+	// cnsenter waits for the sync byte before running the command, so no output is lost before attaching
+	if !o.tty {
+		cnsPod.Spec.Containers[0].Stdin = true
+		cnsPod.Spec.Containers[0].StdinOnce = true
+	}
+
+	// Set cnsenter pod's image
+	if o.cnsPodImage != "" {
+		cnsPod.Spec.Containers[0].Image = o.cnsPodImage
+	}
+
+	// Customize cnsenter pod through shortcut flags and overrides
+	cnsPod, err := o.customizeCnsPod(cnsPod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to customize cnsenter pod : %+v", err)
+	}
+	return cnsPod, nil
+}
+
+// printCnsPod prints cnsenter pod's manifest in yaml or json
+func printCnsPod(w io.Writer, cnsPod *corev1.Pod, output string) error {
+	cnsPod = cnsPod.DeepCopy()
+	cnsPod.APIVersion = "v1"
+	cnsPod.Kind = "Pod"
+
+	var data []byte
+	var err error
+	switch output {
+	case "", outputYAML:
+		data, err = yaml.Marshal(cnsPod)
+	case outputJSON:
+		data, err = json.MarshalIndent(cnsPod, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("%s is not supported output format", output)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal cnsenter pod : %+v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
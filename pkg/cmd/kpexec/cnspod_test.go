@@ -0,0 +1,155 @@
+package kpexec
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildCnsPod(t *testing.T) {
+	tPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "mypod", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node1", DNSPolicy: corev1.DNSClusterFirst},
+	}
+
+	// Default mode
+	o := &Options{cnsPodNamespace: "debug"}
+	cnsPod, err := o.buildCnsPod(tPod, nil, contRuntimeContD, "abc", []string{"date"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cnsenter", "--runtime", contRuntimeContD, "--container", "abc",
+		"--mount", "--pid", "--net", "--ipc", "--uts", "--wd", "--stdin-sync", "--", "date"}
+	cont := cnsPod.Spec.Containers[0]
+	if !reflect.DeepEqual(cont.Command, expected) || cnsPod.Namespace != "debug" || cnsPod.Spec.NodeName != "node1" ||
+		!cnsPod.Spec.HostPID || !*cont.SecurityContext.Privileged || !cont.StdinOnce || len(cnsPod.Spec.Volumes) != 2 {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+
+	// Tools mode mounts container root of runtime
+	o = &Options{cnsPodNamespace: "debug", tools: true, tty: true, cnsPodImage: "registry.local/cnsenter-tools:v1"}
+	cnsPod, err = o.buildCnsPod(tPod, nil, contRuntimeCrio, "abc", []string{"bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont = cnsPod.Spec.Containers[0]
+	if cont.Image != "registry.local/cnsenter-tools:v1" || cnsPod.Spec.DNSPolicy != corev1.DNSClusterFirst ||
+		cnsPod.Spec.Volumes[2].HostPath.Path != contRootCrioPath || cont.VolumeMounts[2].MountPath != contRootCrioPath ||
+		cont.StdinOnce || cont.Command[len(cont.Command)-1] != "bash" ||
+		strings.Contains(strings.Join(cont.Command, " "), "--containerd-state") {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+
+	// Tools mode mounts containerd's state path of node's distribution and passes it to cnsenter
+	k3sNode := &corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: "v1.25.3+k3s1"}}}
+	cnsPod, err = o.buildCnsPod(tPod, k3sNode, contRuntimeContD, "abc", []string{"bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnsPod.Spec.Volumes[2].HostPath.Path != contRootContdK3sPath ||
+		*cnsPod.Spec.Volumes[2].HostPath.Type != corev1.HostPathDirectoryOrCreate ||
+		cnsPod.Spec.Containers[0].VolumeMounts[2].MountPath != contRootContdK3sPath ||
+		!strings.Contains(strings.Join(cnsPod.Spec.Containers[0].Command, " "), "--containerd-state "+contRootContdK3sPath) {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+
+	// Tools mode mounts containerd's socket dir set by option and passes it to cnsenter
+	o.criSocket = "/data/containerd/containerd.sock"
+	cnsPod, err = o.buildCnsPod(tPod, k3sNode, contRuntimeContD, "abc", []string{"bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnsPod.Spec.Volumes[2].HostPath.Path != "/data/containerd" ||
+		cnsPod.Spec.Containers[0].VolumeMounts[2].MountPath != "/data/containerd" ||
+		!strings.Contains(strings.Join(cnsPod.Spec.Containers[0].Command, " "), "--containerd-state /data/containerd") {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+
+	// Tools mode mounts containerd's state path set by option and passes it to cnsenter
+	o.contdStatePath = "/data/containerd/state"
+	cnsPod, err = o.buildCnsPod(tPod, k3sNode, contRuntimeContD, "abc", []string{"bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnsPod.Spec.Volumes[2].HostPath.Path != "/data/containerd/state" ||
+		cnsPod.Spec.Containers[0].VolumeMounts[2].MountPath != "/data/containerd/state" ||
+		!strings.Contains(strings.Join(cnsPod.Spec.Containers[0].Command, " "), "--containerd-state /data/containerd/state") {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+
+	// Not supported runtime in tools mode
+	if _, err := o.buildCnsPod(tPod, nil, "rkt", "abc", []string{"bash"}); err == nil {
+		t.Fatalf("not supported runtime is allowed")
+	}
+}
+
+func TestBuildNodeCnsPod(t *testing.T) {
+	// Default mode enters all namespaces of node's PID 1
+	o := &Options{cnsPodNamespace: "debug"}
+	cnsPod, err := o.buildNodeCnsPod("node1", []string{"date"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cnsenter", "--host", "--mount", "--pid", "--net", "--ipc", "--uts", "--wd", "--stdin-sync", "--", "date"}
+	if !reflect.DeepEqual(cnsPod.Spec.Containers[0].Command, expected) || cnsPod.Spec.NodeName != "node1" || len(cnsPod.Spec.Volumes) != 2 {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+
+	// Tools mode mounts node's root at /host
+	o = &Options{cnsPodNamespace: "debug", tools: true, tty: true}
+	cnsPod, err = o.buildNodeCnsPod("node1", []string{"bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont := cnsPod.Spec.Containers[0]
+	if cnsPod.Spec.Volumes[2].HostPath.Path != nodeRootPath || cont.VolumeMounts[2].MountPath != cnsContNodeRoot ||
+		cnsPod.Spec.DNSPolicy != corev1.DNSDefault || cont.Command[1] != "--host" || cont.Command[len(cont.Command)-1] != "bash" {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+}
+
+func TestBuildSandboxCnsPod(t *testing.T) {
+	tPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default", UID: "uid1"},
+		Spec:       corev1.PodSpec{NodeName: "node1", DNSPolicy: corev1.DNSClusterFirst},
+	}
+	o := &Options{cnsPodNamespace: "debug", criSocket: "/run/k3s/containerd/containerd.sock"}
+	cnsPod, err := o.buildSandboxCnsPod(tPod, "containerd", []string{"ip", "addr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cnsenter", "--runtime", "containerd", "--sandbox", "uid1", "--net", "--ipc", "--uts",
+		"--cri", "/run/k3s/containerd/containerd.sock", "--stdin-sync", "--", "ip", "addr"}
+	if !reflect.DeepEqual(cnsPod.Spec.Containers[0].Command, expected) || cnsPod.Spec.NodeName != "node1" ||
+		cnsPod.Spec.DNSPolicy != corev1.DNSClusterFirst {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+}
+
+func TestPrintCnsPod(t *testing.T) {
+	cnsPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cnsenter-test"}}
+
+	var buf bytes.Buffer
+	if err := printCnsPod(&buf, cnsPod, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "apiVersion: v1\nkind: Pod\n") {
+		t.Fatalf("yaml %s is not expected", buf.String())
+	}
+
+	buf.Reset()
+	if err := printCnsPod(&buf, cnsPod, outputJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"kind": "Pod"`) || cnsPod.Kind != "" {
+		t.Fatalf("json %s is not expected", buf.String())
+	}
+
+	if err := printCnsPod(&buf, cnsPod, "wide"); err == nil {
+		t.Fatalf("wide output is allowed")
+	}
+}
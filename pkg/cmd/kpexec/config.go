@@ -0,0 +1,179 @@
+package kpexec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	configDirName  = "kpexec"
+	configFileName = "config.yaml"
+)
+
+// Config is user's configuration file. Settings of kubeconfig context override default settings
+type Config struct {
+	Defaults Settings            `json:"defaults,omitempty"`
+	Contexts map[string]Settings `json:"contexts,omitempty"`
+}
+
+// Settings are default values of options. Options set by flags win over settings
+type Settings struct {
+	CnsenterNamespace  string   `json:"cnsenterNamespace,omitempty"`
+	CnsenterImage      string   `json:"cnsenterImage,omitempty"`
+	CnsenterToolsImage string   `json:"cnsenterToolsImage,omitempty"`
+	CnsenterTimeout    *int32   `json:"cnsenterTimeout,omitempty"`
+	CRISocket          string   `json:"criSocket,omitempty"`
+	ContainerdState    string   `json:"containerdState,omitempty"`
+	Tools              *bool    `json:"tools,omitempty"`
+	Env                []string `json:"env,omitempty"`
+}
+
+// getConfigPath gets config file's path. XDG_CONFIG_HOME is used instead of ~/.config if it's set
+func getConfigPath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configDir, configDirName, configFileName), nil
+}
+
+// loadConfig loads config file. If config file doesn't exist, it returns empty config
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s : %+v", path, err)
+	}
+	return config, nil
+}
+
+// getSettings merges default settings and context's settings. Envs of context override default envs
+func (c *Config) getSettings(context string) Settings {
+	settings := c.Defaults
+	override, ok := c.Contexts[context]
+	if !ok {
+		return settings
+	}
+
+	if override.CnsenterNamespace != "" {
+		settings.CnsenterNamespace = override.CnsenterNamespace
+	}
+	if override.CnsenterImage != "" {
+		settings.CnsenterImage = override.CnsenterImage
+	}
+	if override.CnsenterToolsImage != "" {
+		settings.CnsenterToolsImage = override.CnsenterToolsImage
+	}
+	if override.CnsenterTimeout != nil {
+		settings.CnsenterTimeout = override.CnsenterTimeout
+	}
+	if override.CRISocket != "" {
+		settings.CRISocket = override.CRISocket
+	}
+	if override.ContainerdState != "" {
+		settings.ContainerdState = override.ContainerdState
+	}
+	if override.Tools != nil {
+		settings.Tools = override.Tools
+	}
+	settings.Env = mergeEnvs(settings.Env, override.Env)
+	return settings
+}
+
+// loadSettings loads settings of the context which kpexec uses
+func (o *Options) loadSettings(clientConfig clientcmd.ClientConfig) (string, Settings, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", Settings{}, fmt.Errorf("failed to get config path : %+v", err)
+	}
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return "", Settings{}, err
+	}
+
+	// Context flag wins over kubeconfig's current context
+	context := o.configOverrides.CurrentContext
+	if context == "" {
+		rawConfig, err := clientConfig.RawConfig()
+		if err != nil {
+			return "", Settings{}, fmt.Errorf("failed to get current context : %+v", err)
+		}
+		context = rawConfig.CurrentContext
+	}
+	return context, config.getSettings(context), nil
+}
+
+// applySettings sets options from settings if options aren't set by flags
+func (o *Options) applySettings(settings Settings, changed func(name string) bool) {
+	if !changed("cnsenter-ns") && settings.CnsenterNamespace != "" {
+		o.cnsPodNamespace = settings.CnsenterNamespace
+	}
+	if !changed("tools") && settings.Tools != nil {
+		o.tools = *settings.Tools
+	}
+	if !changed("cnsenter-img") {
+		if o.tools && settings.CnsenterToolsImage != "" {
+			o.cnsPodImage = settings.CnsenterToolsImage
+		} else if !o.tools && settings.CnsenterImage != "" {
+			o.cnsPodImage = settings.CnsenterImage
+		}
+	}
+	if !changed("cnsenter-to") && settings.CnsenterTimeout != nil {
+		o.cnsPodTimeout = *settings.CnsenterTimeout
+	}
+	if !changed("cri") && settings.CRISocket != "" {
+		o.criSocket = settings.CRISocket
+	}
+	if !changed("containerd-state") && settings.ContainerdState != "" {
+		o.contdStatePath = settings.ContainerdState
+	}
+	o.envs = mergeEnvs(settings.Env, o.envs)
+}
+
+// ViewConfig prints the effective settings of the context including kpexec's defaults
+func (o *Options) ViewConfig(w io.Writer) error {
+	context, settings, err := o.loadSettings(o.newClientConfig())
+	if err != nil {
+		return err
+	}
+
+	// Fill kpexec's defaults
+	imageVersion := strings.TrimPrefix(version, "v")
+	if settings.CnsenterImage == "" {
+		settings.CnsenterImage = fmt.Sprintf("%s:%s", cnsContDefaultImg, imageVersion)
+	}
+	if settings.CnsenterToolsImage == "" {
+		settings.CnsenterToolsImage = fmt.Sprintf("%s:%s", cnsContDefaultToolsImg, imageVersion)
+	}
+	if settings.CnsenterTimeout == nil {
+		timeout := int32(cnsPodDefaultTimeout)
+		settings.CnsenterTimeout = &timeout
+	}
+	if settings.Tools == nil {
+		tools := false
+		settings.Tools = &tools
+	}
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings : %+v", err)
+	}
+	fmt.Fprintf(w, "# context: %s\n%s", context, data)
+	return nil
+}
@@ -0,0 +1,92 @@
+package kpexec
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `defaults:
+  cnsenterNamespace: debug
+  cnsenterImage: registry.local/cnsenter:v1
+  env: [FOO=bar, LANG=C]
+contexts:
+  prod:
+    tools: true
+    cnsenterToolsImage: registry.local/cnsenter-tools:v1
+    cnsenterTimeout: 120
+    criSocket: /run/k3s/containerd/containerd.sock
+    containerdState: /data/containerd/state
+    env: [FOO=baz]
+`
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	// Missing config file is empty config
+	config, err := loadConfig(filepath.Join(dir, "none.yaml"))
+	if err != nil || !reflect.DeepEqual(config, &Config{}) {
+		t.Fatalf("config %v, err %v is not expected", config, err)
+	}
+
+	// Unknown field is error
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("defaults:\n  unknown: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Fatalf("unknown field is allowed")
+	}
+}
+
+func TestGetSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Context without settings gets defaults
+	settings := config.getSettings("dev")
+	if settings.CnsenterNamespace != "debug" || settings.Tools != nil || settings.ContainerdState != "" || !reflect.DeepEqual(settings.Env, []string{"FOO=bar", "LANG=C"}) {
+		t.Fatalf("settings %+v are not expected", settings)
+	}
+
+	// Context's settings override defaults
+	settings = config.getSettings("prod")
+	if settings.CnsenterNamespace != "debug" || settings.Tools == nil || !*settings.Tools ||
+		*settings.CnsenterTimeout != 120 || settings.CRISocket != "/run/k3s/containerd/containerd.sock" ||
+		settings.ContainerdState != "/data/containerd/state" || !reflect.DeepEqual(settings.Env, []string{"LANG=C", "FOO=baz"}) {
+		t.Fatalf("settings %+v are not expected", settings)
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	tools := true
+	timeout := int32(120)
+	settings := Settings{
+		CnsenterNamespace:  "debug",
+		CnsenterImage:      "registry.local/cnsenter:v1",
+		CnsenterToolsImage: "registry.local/cnsenter-tools:v1",
+		CnsenterTimeout:    &timeout,
+		CRISocket:          "/run/k3s/containerd/containerd.sock",
+		ContainerdState:    "/data/containerd/state",
+		Tools:              &tools,
+		Env:                []string{"FOO=bar", "LANG=C"},
+	}
+
+	// Flags win over settings
+	o := &Options{cnsPodNamespace: "kube-system", cnsPodTimeout: cnsPodDefaultTimeout, envs: []string{"FOO=baz"}}
+	changed := map[string]bool{"cnsenter-ns": true}
+	o.applySettings(settings, func(name string) bool { return changed[name] })
+
+	if o.cnsPodNamespace != "kube-system" || !o.tools || o.cnsPodImage != "registry.local/cnsenter-tools:v1" ||
+		o.cnsPodTimeout != 120 || o.criSocket != "/run/k3s/containerd/containerd.sock" || o.contdStatePath != "/data/containerd/state" ||
+		!reflect.DeepEqual(o.envs, []string{"LANG=C", "FOO=baz"}) {
+		t.Fatalf("options %+v are not expected", o)
+	}
+}
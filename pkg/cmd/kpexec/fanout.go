@@ -0,0 +1,241 @@
+package kpexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	outputJSON = "json"
+)
+
+// fanOutResult is the command's result of a pod
+type fanOutResult struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	ExitCode  int    `json:"exitCode"`
+	Error     string `json:"error,omitempty"`
+	Stdout    string `json:"stdout,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+}
+
+func (o *Options) runFanOut(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, target string, cmd []string) error {
+	// Check options
+	if o.tty || o.stdin {
+		return fmt.Errorf("stdin and tty are not supported with multiple pods")
+	}
+	if o.output != "" && o.output != outputJSON {
+		return fmt.Errorf("%s is not supported output format", o.output)
+	}
+	if o.maxConcurrency <= 0 {
+		return fmt.Errorf("max concurrency must be greater than 0")
+	}
+	if o.selector == "" && target == "" {
+		return fmt.Errorf("no target")
+	}
+
+	// Get target pods
+	tPods, err := resolveTargetPods(ctx, clientset, o.tPodNs, target, o.selector)
+	if err != nil {
+		return fmt.Errorf("failed to get target pods' info : %+v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Run the command in %d pods (%s)\n", len(tPods), strings.Join(getPodNames(tPods), ", "))
+
+	// Run the command in each pod with concurrency limit
+	// If outputs are grouped or printed as json, buffer stdout. stderr is buffered only for json, so stderr
+	// isn't compared by grouping. Not buffered outputs are printed with pod/container prefix
+	bufferStdout := o.group || o.output == outputJSON
+	bufferStderr := o.output == outputJSON
+	results := make([]fanOutResult, len(tPods))
+	sem := make(chan struct{}, o.maxConcurrency)
+	var outMutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := range tPods {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			tPod := &tPods[i]
+			result := &results[i]
+			result.Pod = tPod.Name
+			tContName, err := o.getTargetContainerName(tPod, false)
+			if err != nil {
+				result.ExitCode = -1
+				result.Error = err.Error()
+				return
+			}
+			result.Container = tContName
+
+			// Set output writers
+			prefix := fmt.Sprintf("[%s/%s] ", tPod.Name, tContName)
+			stdoutBuf, stderrBuf := &lockedBuffer{}, &lockedBuffer{}
+			stdoutPrefix := newPrefixWriter(os.Stdout, prefix, &outMutex)
+			stderrPrefix := newPrefixWriter(os.Stderr, prefix, &outMutex)
+			var stdout, stderr io.Writer = stdoutPrefix, stderrPrefix
+			if bufferStdout {
+				stdout = stdoutBuf
+			}
+			if bufferStderr {
+				stderr = stderrBuf
+			}
+
+			// Run the command
+			podOpts := *o
+			podOpts.tContName = tContName
+			err = podOpts.runPod(ctx, restConfig, clientset, tPod, cmd, stdout, stderr)
+			var exitErr *ExitCodeError
+			if errors.As(err, &exitErr) {
+				result.ExitCode = exitErr.Code
+			} else if err != nil {
+				result.ExitCode = -1
+				result.Error = err.Error()
+			}
+
+			// Flush outputs
+			result.Stdout = stdoutBuf.String()
+			result.Stderr = stderrBuf.String()
+			stdoutPrefix.Flush()
+			stderrPrefix.Flush()
+		}(i)
+	}
+	wg.Wait()
+
+	// Print grouped outputs and results
+	// Json results include each pod's stdout and stderr
+	if o.output == outputJSON {
+		resultsJSON, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal results : %+v", err)
+		}
+		fmt.Printf("%s\n", resultsJSON)
+	} else {
+		if o.group {
+			printGroupedOutputs(os.Stdout, results)
+		}
+		printResultTable(os.Stdout, results)
+	}
+
+	// Return error if the command failed in any pod
+	for _, result := range results {
+		if result.ExitCode != 0 {
+			return &ExitCodeError{Code: 1, Reason: exitReasonError}
+		}
+	}
+	return nil
+}
+
+func printGroupedOutputs(w io.Writer, results []fanOutResult) {
+	// Group pods by identical stdout in order of appearance
+	var outputs []string
+	groups := map[string][]string{}
+	for _, result := range results {
+		if _, ok := groups[result.Stdout]; !ok {
+			outputs = append(outputs, result.Stdout)
+		}
+		groups[result.Stdout] = append(groups[result.Stdout], result.Pod+"/"+result.Container)
+	}
+
+	for _, output := range outputs {
+		fmt.Fprintf(w, "=== %d pod(s) : %s\n", len(groups[output]), strings.Join(groups[output], ", "))
+		fmt.Fprintf(w, "%s", output)
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+}
+
+func printResultTable(w io.Writer, results []fanOutResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "POD\tCONTAINER\tEXIT CODE\tERROR\n")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", result.Pod, result.Container, result.ExitCode, result.Error)
+	}
+	tw.Flush()
+}
+
+// prefixWriter writes each line with prefix. Lines of multiple writers aren't mixed through mutex
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mutex  *sync.Mutex
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string, mutex *sync.Mutex) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix, mutex: mutex}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+
+	// Write complete lines and keep the incomplete line
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush writes the incomplete line
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
+
+// lockedBuffer is bytes.Buffer which can be read while the stream writes to it
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(data []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.buf.Write(data)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.buf.String()
+}
+
+// Helpers
+func getPodNames(pods []corev1.Pod) []string {
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
@@ -0,0 +1,42 @@
+package kpexec
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mutex sync.Mutex
+	w := newPrefixWriter(&out, "[pod/cont] ", &mutex)
+
+	// Write partial lines
+	w.Write([]byte("line1\nli"))
+	w.Write([]byte("ne2\nline3"))
+	if out.String() != "[pod/cont] line1\n[pod/cont] line2\n" {
+		t.Fatalf("output %q is not expected", out.String())
+	}
+
+	// Flush incomplete line
+	w.Flush()
+	if out.String() != "[pod/cont] line1\n[pod/cont] line2\n[pod/cont] line3\n" {
+		t.Fatalf("output %q is not expected", out.String())
+	}
+}
+
+func TestPrintGroupedOutputs(t *testing.T) {
+	results := []fanOutResult{
+		{Pod: "a", Container: "c", Stdout: "same\n", Stderr: "warning\n"},
+		{Pod: "b", Container: "c", Stdout: "diff\n"},
+		{Pod: "c", Container: "c", Stdout: "same\n"},
+	}
+
+	// stderr isn't compared
+	var out bytes.Buffer
+	printGroupedOutputs(&out, results)
+	expected := "=== 2 pod(s) : a/c, c/c\nsame\n=== 1 pod(s) : b/c\ndiff\n"
+	if out.String() != expected {
+		t.Fatalf("output %q is not expected %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,134 @@
+package kpexec
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	inspectFSDefaultShell = "bash"
+)
+
+var (
+	// Root command's flags which aren't used to inspect the filesystem
+	inspectFSUnsupportedFlags = []string{"selector", "all-pods", "max-concurrency", "group", "sandbox",
+		"pod-running-timeout", "containerd-state"}
+)
+
+// InspectFS runs the command in tools mode cnsenter pod which mounts the target container's snapshot
+// read-only at /croot. The snapshot of the stopped container or the last terminated container is used
+func (o *Options) InspectFS(args []string, argsLenAtDash int) error {
+	// Check inputs
+	for _, name := range inspectFSUnsupportedFlags {
+		if o.changed(name) {
+			return fmt.Errorf("--%s is not supported with --inspect-fs", name)
+		}
+	}
+	target, cmd, err := parseInspectFSArgs(args, argsLenAtDash)
+	if err != nil {
+		return err
+	}
+	switch o.dryRun {
+	case dryRunNone:
+	case dryRunClient, dryRunServer:
+		if o.output != "" && o.output != outputYAML && o.output != outputJSON {
+			return fmt.Errorf("%s is not supported output format", o.output)
+		}
+	default:
+		return fmt.Errorf("%s is not supported dry run mode", o.dryRun)
+	}
+
+	ctx := context.Background()
+
+	// Init k8s clientset
+	clientConfig := o.newClientConfig()
+	restConfig, err := newRestConfig(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set rest config : %+v", err)
+	}
+	clientset, err := newClientset(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set clientset : %+v", err)
+	}
+
+	// Always use tools mode, since the snapshot is mounted in cnsenter pod
+	_, settings, err := o.loadSettings(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load config : %+v", err)
+	}
+	o.tools = true
+	o.applySettings(settings, func(name string) bool { return name == "tools" || o.changed(name) })
+
+	// Get namespace
+	if o.tPodNs == "" {
+		o.tPodNs, err = getNamespace(clientConfig)
+		if err != nil {
+			return fmt.Errorf("failed to get namespace : %+v", err)
+		}
+	}
+	if o.cnsPodNamespace == "" {
+		o.cnsPodNamespace = o.tPodNs
+	}
+
+	// Get target pod and container's info
+	interactive := isInteractive()
+	tPod, err := o.selectTargetPod(ctx, clientset, target, interactive)
+	if err != nil {
+		return fmt.Errorf("failed to get target pod's info : %+v", err)
+	}
+	o.tContName, err = o.getTargetContainerName(tPod, interactive)
+	if err != nil {
+		return fmt.Errorf("failed to get target container's info : %+v", err)
+	}
+	tContRuntime, tContID, err := getSnapshotContainerRuntimeID(tPod, o.tContName)
+	if err != nil {
+		return fmt.Errorf("failed to get target container's info : %+v", err)
+	}
+
+	// Build and run cnsenter pod
+	cnsPod, err := o.buildInspectFSCnsPod(tPod, tContRuntime, tContID, cmd)
+	if err != nil {
+		return err
+	}
+	return o.runCnsPod(ctx, restConfig, clientset, cnsPod, os.Stdout, os.Stderr)
+}
+
+// parseInspectFSArgs gets target and command from args. If command is omitted, shell is run
+func parseInspectFSArgs(args []string, argsLenAtDash int) (string, []string, error) {
+	if len(args) == 0 || argsLenAtDash == 0 {
+		return "", nil, fmt.Errorf("no target")
+	} else if argsLenAtDash >= 2 {
+		return "", nil, fmt.Errorf("wrong target")
+	}
+	if len(args) == 1 {
+		return args[0], []string{inspectFSDefaultShell}, nil
+	}
+	return args[0], args[1:], nil
+}
+
+// getSnapshotContainerRuntimeID gets runtime and ID of the container. If the container is waiting to restart,
+// the last terminated container's ID is used
+func getSnapshotContainerRuntimeID(pod *corev1.Pod, containerName string) (string, string, error) {
+	status, err := getContainerStatus(pod, containerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	contID := status.ContainerID
+	if contID == "" && status.LastTerminationState.Terminated != nil {
+		contID = status.LastTerminationState.Terminated.ContainerID
+	}
+	if contID == "" {
+		return "", "", fmt.Errorf("container %s is not created yet", containerName)
+	}
+
+	u, err := url.Parse(contID)
+	if err != nil {
+		return "", "", fmt.Errorf("parse container ID error")
+	}
+	return u.Scheme, u.Host, nil
+}
@@ -0,0 +1,96 @@
+package kpexec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseInspectFSArgs(t *testing.T) {
+	tests := []struct {
+		args          []string
+		argsLenAtDash int
+		target        string
+		cmd           []string
+		isErr         bool
+	}{
+		{[]string{"pod1"}, -1, "pod1", []string{inspectFSDefaultShell}, false},
+		{[]string{"pod1", "ls", "/croot"}, -1, "pod1", []string{"ls", "/croot"}, false},
+		{[]string{"pod1", "ls"}, 1, "pod1", []string{"ls"}, false},
+		{[]string{"ls"}, 0, "", nil, true},
+		{nil, -1, "", nil, true},
+	}
+
+	for _, test := range tests {
+		target, cmd, err := parseInspectFSArgs(test.args, test.argsLenAtDash)
+		if (err != nil) != test.isErr || target != test.target || !reflect.DeepEqual(cmd, test.cmd) {
+			t.Fatalf("args %v are parsed to %s %v %v", test.args, target, cmd, err)
+		}
+	}
+}
+
+func TestInspectFSUnsupportedFlags(t *testing.T) {
+	for _, name := range inspectFSUnsupportedFlags {
+		o := &Options{changed: func(flag string) bool { return flag == name }}
+		if err := o.InspectFS([]string{"pod1"}, -1); err == nil || !strings.Contains(err.Error(), name) {
+			t.Fatalf("flag %s makes err %v", name, err)
+		}
+	}
+}
+
+func TestGetSnapshotContainerRuntimeID(t *testing.T) {
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:  "crash",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ContainerID: "containerd://abc", ExitCode: 1},
+					},
+				},
+				{
+					Name:        "stopped",
+					ContainerID: "cri-o://def",
+					State:       corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ContainerID: "cri-o://def"}},
+				},
+				{
+					Name:  "pending",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+				},
+			},
+		},
+	}
+
+	// The last terminated container is used if the container is waiting to restart
+	if runtime, id, err := getSnapshotContainerRuntimeID(pod, "crash"); err != nil || runtime != "containerd" || id != "abc" {
+		t.Fatalf("runtime %s and ID %s are not expected : %v", runtime, id, err)
+	}
+	if runtime, id, err := getSnapshotContainerRuntimeID(pod, "stopped"); err != nil || runtime != "cri-o" || id != "def" {
+		t.Fatalf("runtime %s and ID %s are not expected : %v", runtime, id, err)
+	}
+	if _, _, err := getSnapshotContainerRuntimeID(pod, "pending"); err == nil {
+		t.Fatalf("container which is not created has no snapshot")
+	}
+}
+
+func TestBuildInspectFSCnsPod(t *testing.T) {
+	tPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	}
+	o := &Options{cnsPodNamespace: "debug", tools: true, tty: true, envs: []string{"TERM=vt100"}}
+	cnsPod, err := o.buildInspectFSCnsPod(tPod, "containerd", "abc", []string{"bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cnsenter", "--runtime", "containerd", "--container", "abc", "--snapshot", cnsContDefaultToolsRoot}
+	cont := cnsPod.Spec.Containers[0]
+	if !reflect.DeepEqual(cont.Command[:len(expected)], expected) || cont.Command[len(cont.Command)-1] != "bash" ||
+		cnsPod.Spec.NodeName != "node1" || !cnsPod.Spec.HostPID {
+		t.Fatalf("cnsenter pod %+v is not expected", cnsPod)
+	}
+}
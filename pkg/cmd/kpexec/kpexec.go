@@ -3,12 +3,12 @@ package kpexec
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/url"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strings"
 	"syscall"
@@ -16,11 +16,15 @@ import (
 
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // Init package
@@ -39,11 +43,29 @@ const (
 	cnsPodLabelKey       = "kpexec.ssup2"
 	cnsPodLabelValue     = "cnsenter"
 
+	signalDefaultGrace = 10
+
+	podRunningDefaultTimeout = time.Minute
+
+	fanOutDefaultConcurrency = 5
+
 	cnsContName             = "cnsenter"
 	cnsContDefaultImg       = "ssup2/cnsenter"
 	cnsContDefaultToolsImg  = "ssup2/cnsenter-tools"
 	cnsContDefaultToolsRoot = "/croot"
+	cnsContNodeRoot         = "/host"
 	cnsContProcRemountExec  = "remount-proc-exec"
+	cnsStdinSyncByte        = 0
+	cnsDefaultTerm          = "xterm"
+
+	cnsContTerminatedTimeout  = 10
+	cnsContTerminatedInterval = 500
+
+	cnsPodDeleteTimeout  = 60
+	cnsPodDeleteInterval = 500
+
+	exitReasonCompleted = "Completed"
+	exitReasonError     = "Error"
 
 	criSocketVolumeRun = "cri-socket-run"
 	criSocketPathRun   = "/run"
@@ -61,8 +83,11 @@ const (
 	contRootDockerVolume = "container-docker-root"
 	contRootDockerPath   = "/var/lib/docker"
 
+	nodeRootVolume = "node-root"
+	nodeRootPath   = "/"
+
 	flagHelpTemplate   = "help for {{.binary}}"
-	cmdUseTemplate     = "{{.binary}} [-n NAMESPACE] POD [-c CONTAINER] -- COMMAND [args...]"
+	cmdUseTemplate     = "{{.binary}} [-n NAMESPACE] POD | TYPE/NAME [-c CONTAINER] [--] COMMAND [args...]"
 	cmdExampleTemplate = `
 		# Get output from running 'date' command from pod mypod, using the first container by default
 		{{.binary}} mypod -- date
@@ -70,13 +95,44 @@ const (
 		# Get output from running 'date' command in date-container from pod mypod and namespace mynamespace 
 		{{.binary}} -n mynamespace mypod -c date-container -- date
 
+		# Get output from running 'date' command from a ready pod of deployment mydeploy
+		# TYPE can be deploy, sts, ds, rs, job, svc and node
+		{{.binary}} deploy/mydeploy -- date
+
+		# Debug network of the pod whose container keeps crashing through pod sandbox's namespaces
+		{{.binary}} -it -T --sandbox mypod -- bash
+
+		# Get node's root shell in the host namespaces of node1
+		{{.binary}} -it node/node1 -- bash
+
+		# Get output from running 'date' command in all pods matched by label selector
+		{{.binary}} -l app=myapp -- date
+
+		# Get output from running 'date' command in all pods of deployment mydeploy with grouped outputs
+		{{.binary}} deploy/mydeploy --all-pods --group -- date
+
+		# Double dash can be omitted if the command doesn't have flags
+		{{.binary}} mypod date
+
 		# Switch to raw terminal mode, sends stdin to 'bash' in bash-container from pod mypod
 		# and sends stdout/stderr from 'bash' back to the client
 		{{.binary}} -it mypod -c bash-container -- bash
 
+		# Without -t option, stdout and stderr are kept separated. Binary output can be redirected
+		{{.binary}} mypod -- tar c /data > out.tar
+
 		# Enable 'tools' mode
 		{{.binary}} -it -T mypod -c bash-container -- bash
 
+		# Get shell with the filesystem of crashed container app-container from pod mypod at /croot
+		{{.binary}} -it --inspect-fs mypod -c app-container
+
+		# Copy a core file written by the last terminated container
+		{{.binary}} --inspect-fs mypod -c app-container -- cat /croot/tmp/core > core
+
+		# Override forwarded TERM, LANG, LC_*, COLUMNS and LINES envs
+		{{.binary}} -it --env TERM=vt100 mypod -c bash-container -- bash
+
 		# Set cnsenter pod's image
 		{{.binary}} -it -T --cnsenter-img=ssup2/my-cnsenter-tools:latest mypod -c bash-container -- bash
 
@@ -92,6 +148,22 @@ const (
 var (
 	version = "latest"
 	build   = buildStandAlone
+
+	// kubectl's global flags which don't affect kpexec
+	kubectlIgnoredFlags     = []string{"cache-dir", "profile", "profile-output", "vmodule"}
+	kubectlIgnoredBoolFlags = []string{"match-server-version", "warnings-as-errors"}
+
+	signalNames = map[os.Signal]string{
+		syscall.SIGHUP:  "SIGHUP",
+		syscall.SIGINT:  "SIGINT",
+		syscall.SIGTERM: "SIGTERM",
+		syscall.SIGQUIT: "SIGQUIT",
+	}
+	// Control characters which the remote TTY turns into signals
+	signalCtrlChars = map[os.Signal]byte{
+		syscall.SIGINT:  0x03, // ^C
+		syscall.SIGQUIT: 0x1c, // ^\
+	}
 )
 
 // Cmd
@@ -116,6 +188,7 @@ func New() *cobra.Command {
 		Short:                 "Execute a command with privilige in a container.",
 		Long:                  "Execute a command with privilige in a container.",
 		Example:               cmdExample,
+		Args:                  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			if options.help {
 				cmd.Help()
@@ -123,17 +196,44 @@ func New() *cobra.Command {
 				fmt.Printf("version: %s\n", version)
 			} else if len(options.completion) != 0 {
 				if err := options.Complete(cmd, args); err != nil {
-					fmt.Printf("Failed to get bash/zsh completion : %+v\n", err)
+					fmt.Fprintf(os.Stderr, "Failed to get bash/zsh completion : %+v\n", err)
+					os.Exit(1)
+				}
+			} else if options.configView {
+				if err := options.ViewConfig(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to view config : %+v\n", err)
 					os.Exit(1)
 				}
 			} else if options.cnsPodGC {
-				if err := options.GarbageCollect(); err != nil {
-					fmt.Printf("Failed to run cnsenter pod's garbage collector : %+v\n", err)
+				// Stop collecting by signals
+				ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+				defer stop()
+				if err := options.GarbageCollect(ctx); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to run cnsenter pod's garbage collector : %+v\n", err)
+					os.Exit(1)
+				}
+			} else if options.inspectFS {
+				if err := options.InspectFS(args, cmd.ArgsLenAtDash()); err != nil {
+					var exitErr *ExitCodeError
+					if errors.As(err, &exitErr) {
+						os.Exit(exitErr.Code)
+					}
+
+					fmt.Fprintf(os.Stderr, "Failed to inspect filesystem : %+v\n", err)
 					os.Exit(1)
 				}
 			} else {
 				if err := options.Run(args, cmd.ArgsLenAtDash()); err != nil {
-					fmt.Printf("Failed to run kpexec err : %+v\n", err)
+					// Exit with the remote command's exit code
+					var exitErr *ExitCodeError
+					if errors.As(err, &exitErr) {
+						if exitErr.Reason != exitReasonCompleted && exitErr.Reason != exitReasonError {
+							fmt.Fprintf(os.Stderr, "%s\n", exitErr.Error())
+						}
+						os.Exit(exitErr.Code)
+					}
+
+					fmt.Fprintf(os.Stderr, "Failed to run kpexec err : %+v\n", err)
 					os.Exit(1)
 				}
 			}
@@ -143,25 +243,74 @@ func New() *cobra.Command {
 
 	// Set flags
 	cmd.Flags().StringVarP(&options.tPodNs, "namespace", "n", "", "If present, the namespace scope for this CLI request")
-	cmd.Flags().StringVarP(&options.tContName, "container", "c", "", "Container name. If omitted, the first container in the pod will be chosen")
+	cmd.Flags().StringVarP(&options.tContName, "container", "c", "", "Container name, index or unique prefix including init and ephemeral containers. If omitted, the default container annotation or the first container in the pod will be chosen")
 	cmd.Flags().BoolVarP(&options.stdin, "stdin", "i", false, "Pass stdin to the container")
 	cmd.Flags().BoolVarP(&options.tty, "tty", "t", false, "Stdin is a TTY")
 	cmd.Flags().BoolVarP(&options.tools, "tools", "T", false, "Use tools mode")
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", "", "Selector (label query) to run the command in all matched pods")
+	cmd.Flags().BoolVar(&options.allPods, "all-pods", false, "Run the command in all pods of the target workload or service")
+	cmd.Flags().IntVar(&options.maxConcurrency, "max-concurrency", fanOutDefaultConcurrency, "Set the maximum number of pods running the command at the same time")
+	cmd.Flags().BoolVar(&options.group, "group", false, "Collapse identical outputs of pods into a grouped summary")
+	cmd.Flags().StringVarP(&options.output, "output", "o", "", "Output format of pods' results (json) or cnsenter pod in dry run (yaml, json). If omitted, print a table or yaml")
+	cmd.Flags().BoolVar(&options.sandbox, "sandbox", false, "Enter network, IPC and UTS namespaces of the pod sandbox instead of the container. Useful when the container keeps crashing")
+	cmd.Flags().DurationVar(&options.podRunningTimeout, "pod-running-timeout", podRunningDefaultTimeout, "The length of time (like 5s, 2m, or 3h, higher than zero) to wait until the target container is running")
+	cmd.Flags().BoolVar(&options.inspectFS, "inspect-fs", false, "Inspect the filesystem of a container including stopped or crashed one in tools mode. The container's snapshot is mounted read-only at /croot and shell is run if the command is omitted")
+	cmd.Flags().StringArrayVar(&options.envs, "env", nil, "Set an environment variable (KEY=VALUE) for the command. It overrides forwarded TERM, LANG, LC_*, COLUMNS and LINES")
 
 	cmd.Flags().StringVar(&options.cnsPodNamespace, "cnsenter-ns", "", "Set cnsenter pod's namespace (default target pod's namespace)")
 	cmd.Flags().StringVar(&options.cnsPodImage, "cnsenter-img", "", fmt.Sprintf("Set cnsenter pod's img (default mode ssup2/cnsenter:%s / tools mode ssup2/cnsenter-tools:%s)", version, version))
 	cmd.Flags().Int32Var(&options.cnsPodTimeout, "cnsenter-to", cnsPodDefaultTimeout, "Set cnsenter pod's creation timeout")
 	cmd.Flags().BoolVar(&options.cnsPodGC, "cnsenter-gc", false, "Run cnsenter pod garbage collector")
+	cmd.Flags().BoolVar(&options.waitDelete, "wait-delete", false, "Wait until cnsenter pod is deleted before exit")
+	cmd.Flags().Int32Var(&options.signalGrace, "signal-grace", signalDefaultGrace, "Set grace timeout to delete cnsenter pod after forwarding a signal to the command")
+	cmd.Flags().StringVar(&options.cnsPodOverrides, "cnsenter-overrides", "", "Patch cnsenter pod with inline JSON or JSON/YAML file. Object is strategic merge patch and array is JSON patch")
+	cmd.Flags().StringArrayVar(&options.cnsPodPullSecrets, "cnsenter-pull-secret", nil, "Set cnsenter pod's image pull secret. This flag can be repeated")
+	cmd.Flags().StringVar(&options.cnsPodPullPolicy, "cnsenter-pull-policy", "", "Set cnsenter container's image pull policy (Always, IfNotPresent, Never)")
+	cmd.Flags().StringArrayVar(&options.cnsPodLabels, "cnsenter-label", nil, "Set cnsenter pod's label (KEY=VALUE). This flag can be repeated")
+	cmd.Flags().StringArrayVar(&options.cnsPodAnnotations, "cnsenter-annotation", nil, "Set cnsenter pod's annotation (KEY=VALUE). This flag can be repeated")
+	cmd.Flags().StringVar(&options.cnsPodRequests, "cnsenter-requests", "", "Set cnsenter container's resource requests (like cpu=100m,memory=64Mi)")
+	cmd.Flags().StringVar(&options.cnsPodLimits, "cnsenter-limits", "", "Set cnsenter container's resource limits (like cpu=500m,memory=256Mi)")
+	cmd.Flags().StringVar(&options.dryRun, "dry-run", dryRunNone, "Print cnsenter pod without running it (none, client, server). Server dry run checks admission without persisting it")
 
 	cmd.Flags().StringVar(&options.kubeconfig, "kubeconfig", "", "Absolute path to the kubeconfig file")
+	cmd.Flags().StringVar(&options.configOverrides.CurrentContext, "context", "", "The name of the kubeconfig context to use")
+	cmd.Flags().StringVar(&options.configOverrides.Context.Cluster, "cluster", "", "The name of the kubeconfig cluster to use")
+	cmd.Flags().StringVar(&options.configOverrides.Context.AuthInfo, "user", "", "The name of the kubeconfig user to use")
+	cmd.Flags().StringVarP(&options.configOverrides.ClusterInfo.Server, "server", "s", "", "The address and port of the Kubernetes API server")
+	cmd.Flags().StringVar(&options.configOverrides.AuthInfo.Token, "token", "", "Bearer token for authentication to the API server")
+	cmd.Flags().StringVar(&options.configOverrides.AuthInfo.Impersonate, "as", "", "Username to impersonate for the operation")
+	cmd.Flags().StringArrayVar(&options.configOverrides.AuthInfo.ImpersonateGroups, "as-group", nil, "Group to impersonate for the operation, this flag can be repeated to specify multiple groups")
+	cmd.Flags().BoolVar(&options.configOverrides.ClusterInfo.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "If true, the server's certificate will not be checked for validity")
+	cmd.Flags().StringVar(&options.configOverrides.Timeout, "request-timeout", "0", "The length of time to wait before giving up on a single server request (like 1s, 2m, 3h). Zero means don't timeout requests")
+	if build == buildKubectlPlugin {
+		// Accept the rest of kubectl's global flags, which kubectl passes to plugins as they are
+		cmd.Flags().StringVar(&options.configOverrides.ClusterInfo.CertificateAuthority, "certificate-authority", "", "Path to a cert file for the certificate authority")
+		cmd.Flags().StringVar(&options.configOverrides.AuthInfo.ClientCertificate, "client-certificate", "", "Path to a client certificate file for TLS")
+		cmd.Flags().StringVar(&options.configOverrides.AuthInfo.ClientKey, "client-key", "", "Path to a client key file for TLS")
+		cmd.Flags().StringVar(&options.configOverrides.ClusterInfo.TLSServerName, "tls-server-name", "", "Server name to use for server certificate validation")
+		cmd.Flags().StringVar(&options.configOverrides.AuthInfo.Username, "username", "", "Username for basic authentication to the API server")
+		cmd.Flags().StringVar(&options.configOverrides.AuthInfo.Password, "password", "", "Password for basic authentication to the API server")
+		for _, name := range kubectlIgnoredFlags {
+			cmd.Flags().String(name, "", "Ignored kubectl's global flag")
+			cmd.Flags().MarkHidden(name)
+		}
+		for _, name := range kubectlIgnoredBoolFlags {
+			cmd.Flags().Bool(name, false, "Ignored kubectl's global flag")
+			cmd.Flags().MarkHidden(name)
+		}
+	}
 	cmd.Flags().StringVar(&options.criSocket, "cri", "", "CRI socket path")
+	cmd.Flags().StringVar(&options.contdStatePath, "containerd-state", "", "containerd state dir of the node mounted in tools mode (default: detected from the node)")
 
 	cmd.Flags().BoolVarP(&options.help, "help", "h", false, flagHelp)
 	cmd.Flags().BoolVarP(&options.version, "version", "v", false, "Show version")
+	cmd.Flags().BoolVar(&options.configView, "config-view", false, "Show the effective settings of the kubeconfig context merged from config file (~/.config/kpexec/config.yaml) and defaults")
 	if build == buildStandAlone {
 		cmd.Flags().StringVar(&options.completion, "completion", "", "Output shell completion code for the specified shell (bash or zsh)")
 	}
 
+	options.changed = func(name string) bool { return cmd.Flags().Changed(name) }
+
 	// Set bash completion flags
 	for name, completion := range bashCompletionFlags {
 		cmd.Flag(name).Annotations = map[string][]string{}
@@ -174,6 +323,16 @@ func New() *cobra.Command {
 	return cmd
 }
 
+// ExitCodeError
+type ExitCodeError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %d (%s)", e.Code, e.Reason)
+}
+
 // kpexecOptions
 type Options struct {
 	tPodNs    string
@@ -181,18 +340,46 @@ type Options struct {
 	tty       bool
 	stdin     bool
 	tools     bool
+	envs      []string
+
+	podRunningTimeout time.Duration
+	sandbox           bool
+	inspectFS         bool
+
+	selector       string
+	allPods        bool
+	maxConcurrency int
+	group          bool
+	output         string
 
 	cnsPodNamespace string
 	cnsPodImage     string
 	cnsPodTimeout   int32
 	cnsPodGC        bool
-
-	kubeconfig string
-	criSocket  string
+	waitDelete      bool
+	signalGrace     int32
+
+	cnsPodOverrides   string
+	cnsPodPullSecrets []string
+	cnsPodPullPolicy  string
+	cnsPodLabels      []string
+	cnsPodAnnotations []string
+	cnsPodRequests    string
+	cnsPodLimits      string
+	dryRun            string
+
+	kubeconfig      string
+	configOverrides clientcmd.ConfigOverrides
+	criSocket       string
+	contdStatePath  string
 
 	help       bool
 	version    bool
+	configView bool
 	completion string
+
+	// changed returns true if the option is set by flag
+	changed func(name string) bool
 }
 
 func (o *Options) Complete(cmd *cobra.Command, args []string) error {
@@ -221,15 +408,23 @@ func (o *Options) Complete(cmd *cobra.Command, args []string) error {
 	return fmt.Errorf("%s is not supported shell", o.completion)
 }
 
-func (o *Options) GarbageCollect() error {
+func (o *Options) GarbageCollect(ctx context.Context) error {
 	// Init k8s client set
-	clientset, err := newClientset(o.kubeconfig)
+	restConfig, err := newRestConfig(o.newClientConfig())
+	if err != nil {
+		return fmt.Errorf("failed to set rest config : %+v", err)
+	}
+	clientset, err := newClientset(restConfig)
 	if err != nil {
 		return fmt.Errorf("failed to set clientset : %+v", err)
 	}
+	return o.deleteNotRunningCnsPods(ctx, clientset)
+}
 
+// deleteNotRunningCnsPods deletes all cnsenter pods which aren't running. It stops when the context is canceled
+func (o *Options) deleteNotRunningCnsPods(ctx context.Context, clientset kubernetes.Interface) error {
 	// Get target pod's info
-	cnsPods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
+	cnsPods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
 		LabelSelector: cnsPodLabelKey + "=" + cnsPodLabelValue,
 	})
 	if err != nil {
@@ -241,11 +436,14 @@ func (o *Options) GarbageCollect() error {
 		if cnsPod.Status.Phase == corev1.PodRunning {
 			continue
 		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("canceled to delete cnsenter pods")
+		}
 
 		// Delete cnsenter pod
-		fmt.Printf("Delete cnsenter pod : %s\n", cnsPod.Name)
-		if err := clientset.CoreV1().Pods(cnsPod.Namespace).Delete(context.TODO(), cnsPod.Name, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Failed to delete to cnsenter pod : %+v\n", err)
+		fmt.Fprintf(os.Stderr, "Delete cnsenter pod : %s\n", cnsPod.Name)
+		if err := clientset.CoreV1().Pods(cnsPod.Namespace).Delete(ctx, cnsPod.Name, metav1.DeleteOptions{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete to cnsenter pod : %+v\n", err)
 		}
 	}
 	return nil
@@ -253,408 +451,553 @@ func (o *Options) GarbageCollect() error {
 
 func (o *Options) Run(args []string, argsLenAtDash int) error {
 	// Check inputs
-	// Check pod name by using double dash
-	if argsLenAtDash == -1 {
-		return fmt.Errorf("no double dash")
-	} else if argsLenAtDash == 0 {
-		return fmt.Errorf("no target pod name")
-	} else if argsLenAtDash >= 2 {
-		return fmt.Errorf("wrong pod name")
+	// Get target and command
+	target, tPodCmd, err := parseArgs(args, argsLenAtDash, o.selector == "")
+	if err != nil {
+		return err
 	}
-	// Check commands
-	if len(args) <= 1 {
-		return fmt.Errorf("no commands")
+
+	// Check dry run mode
+	switch o.dryRun {
+	case dryRunNone:
+	case dryRunClient, dryRunServer:
+		if o.selector != "" || o.allPods {
+			return fmt.Errorf("dry run is not supported with multiple pods")
+		}
+		if o.output != "" && o.output != outputYAML && o.output != outputJSON {
+			return fmt.Errorf("%s is not supported output format", o.output)
+		}
+	default:
+		return fmt.Errorf("%s is not supported dry run mode", o.dryRun)
 	}
 
-	tPodName := args[argsLenAtDash-1]
-	tPodCmd := args[argsLenAtDash:]
+	// Set context for creating, waiting, attaching and getting logs
+	ctx := context.Background()
 
 	// Init k8s clientset
-	clientset, err := newClientset(o.kubeconfig)
+	// Rest config and namespace are got from the same kubeconfig and overrides
+	clientConfig := o.newClientConfig()
+	restConfig, err := newRestConfig(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set rest config : %+v", err)
+	}
+	clientset, err := newClientset(restConfig)
 	if err != nil {
 		return fmt.Errorf("failed to set clientset : %+v", err)
 	}
 
+	// Set options not set by flags from the context's settings in config file
+	_, settings, err := o.loadSettings(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load config : %+v", err)
+	}
+	o.applySettings(settings, o.changed)
+
 	// Get namespace
 	// If not set target pod's namespace, Get default namespace from kubeconfig
 	if o.tPodNs == "" {
-		o.tPodNs, err = getNamespaceByKubeconfig(o.kubeconfig)
+		o.tPodNs, err = getNamespace(clientConfig)
 		if err != nil {
-			return fmt.Errorf("failed to set clientset : %+v", err)
+			return fmt.Errorf("failed to get namespace : %+v", err)
+		}
+	}
+
+	// Set cnsenter pod's namespace
+	if o.cnsPodNamespace == "" {
+		o.cnsPodNamespace = o.tPodNs
+	}
+
+	// Run the command in the host namespaces of the node
+	if targetType, nodeName, err := parseTarget(target); err == nil && targetType == targetTypeNode {
+		if o.allPods {
+			return fmt.Errorf("all pods option is not supported with node")
+		}
+		if o.sandbox {
+			return fmt.Errorf("sandbox option is not supported with node")
 		}
+		return o.runNode(ctx, restConfig, clientset, nodeName, tPodCmd, os.Stdout, os.Stderr)
+	}
+
+	// Run the command in multiple pods
+	if o.selector != "" || o.allPods {
+		return o.runFanOut(ctx, restConfig, clientset, target, tPodCmd)
 	}
 
 	// Get target pod's info
-	tPod, err := clientset.CoreV1().Pods(o.tPodNs).Get(context.TODO(), tPodName, metav1.GetOptions{})
+	// Target can be pod or workload, service reference (TYPE/NAME)
+	// If target is omitted or ambiguous, select it through picker in terminal
+	interactive := isInteractive()
+	tPod, err := o.selectTargetPod(ctx, clientset, target, interactive)
 	if err != nil {
 		return fmt.Errorf("failed to get target pod's info : %+v", err)
 	}
-	tPodNodeName := tPod.Spec.NodeName
-	if o.tContName == "" {
-		// Get first container name
-		o.tContName = tPod.Spec.Containers[0].Name
-		fmt.Printf("Defaulting container name to %s.\n", o.tContName)
+	// Sandbox mode doesn't need a running container
+	if !o.sandbox {
+		o.tContName, err = o.getTargetContainerName(tPod, interactive)
+		if err != nil {
+			return fmt.Errorf("failed to get target container's info : %+v", err)
+		}
+
+		// Wait for target container to be running if target pod is just created
+		tPod, err = waitTargetContainerRunning(ctx, clientset, tPod, o.tContName, o.podRunningTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to wait for target container : %+v", err)
+		}
 	}
+	return o.runPod(ctx, restConfig, clientset, tPod, tPodCmd, os.Stdout, os.Stderr)
+}
 
-	// Get target container's info
-	tContRuntime, tContID, err := getContainerRuntimeID(tPod, o.tContName)
+func (o *Options) runPod(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, tPod *corev1.Pod,
+	tPodCmd []string, stdout, stderr io.Writer) error {
+	// Enter pod sandbox's namespaces in sandbox mode
+	if o.sandbox {
+		tContRuntime, err := getPodRuntime(tPod)
+		if err != nil {
+			return fmt.Errorf("failed to get target pod's info : %+v", err)
+		}
+		cnsPod, err := o.buildSandboxCnsPod(tPod, tContRuntime, tPodCmd)
+		if err != nil {
+			return err
+		}
+		return o.runCnsPod(ctx, restConfig, clientset, cnsPod, stdout, stderr)
+	}
+
+	tContName, err := o.getTargetContainerName(tPod, false)
 	if err != nil {
 		return fmt.Errorf("failed to get target container's info : %+v", err)
 	}
 
-	// Create and set defer to delete cnsenter pod
-	// Config cnsenter pod
-	cnsPodName := fmt.Sprintf("cnsenter-%s", getRandomString(10))
-	cnsCRISocketVolumeType := corev1.HostPathDirectory
-	cnsContRootVolumeType := corev1.HostPathDirectory
-	cnsPrivileged := true
-
-	cnsPod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: cnsPodName,
-			Labels: map[string]string{
-				cnsPodLabelKey: cnsPodLabelValue,
-			},
-		},
-		Spec: corev1.PodSpec{
-			NodeName: tPodNodeName,
-			Containers: []corev1.Container{
-				{
-					Name:  cnsContName,
-					Stdin: o.stdin,
-					TTY:   o.tty,
-					VolumeMounts: []corev1.VolumeMount{
-						{
-							Name:      criSocketVolumeRun,
-							MountPath: criSocketPathRun,
-						},
-						{
-							Name:      criSocketVolumeVar,
-							MountPath: criSocketPathVar,
-						},
-					},
-					SecurityContext: &corev1.SecurityContext{
-						Privileged: &cnsPrivileged,
-					},
-				},
-			},
-			Volumes: []corev1.Volume{
-				{
-					Name: criSocketVolumeRun,
-					VolumeSource: corev1.VolumeSource{
-						HostPath: &corev1.HostPathVolumeSource{
-							Type: &cnsCRISocketVolumeType,
-							Path: criSocketPathRun,
-						},
-					},
-				},
-				{
-					Name: criSocketVolumeVar,
-					VolumeSource: corev1.VolumeSource{
-						HostPath: &corev1.HostPathVolumeSource{
-							Type: &cnsCRISocketVolumeType,
-							Path: criSocketPathVar,
-						},
-					},
-				},
-			},
-			Tolerations: []corev1.Toleration{
-				{
-					Operator: corev1.TolerationOpExists,
-				},
-			},
-			HostPID:       true,
-			RestartPolicy: "Never",
-		},
+	// Get target container's info
+	tContRuntime, tContID, err := getContainerRuntimeID(tPod, tContName)
+	if err != nil {
+		return fmt.Errorf("failed to get target container's info : %+v", err)
 	}
 
+	// Get target node to mount the runtime's paths of the node's distribution in tools mode
+	var tNode *corev1.Node
 	if o.tools {
-		// For tools mode
-		// Use tools image
-		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultToolsImg, strings.TrimPrefix(version, "v"))
-
-		// Set command
-		// Do not enter mount namespace
-		// Create new mount namespace and remount procfs
-		cnsPodCmd := []string{"cnsenter", "--runtime", tContRuntime, "--container", tContID,
-			"--pid", "--net", "--ipc", "--uts", "--root-symlink", cnsContDefaultToolsRoot,
-			"--wd", "--wd-base", cnsContDefaultToolsRoot, "--env", "TERM=xterm"}
-		if o.criSocket != "" {
-			cnsPodCmd = append(cnsPodCmd, "--cri", o.criSocket)
-		}
-		cnsPodCmd = append(cnsPodCmd, "--", "unshare", "--mount", cnsContProcRemountExec)
-		cnsPodCmd = append(cnsPodCmd, tPodCmd...)
-		cnsPod.Spec.Containers[0].Command = cnsPodCmd
-
-		// Copy DNS settings from target pod
-		cnsPod.Spec.DNSPolicy = tPod.Spec.DeepCopy().DNSPolicy
-		cnsPod.Spec.DNSConfig = tPod.Spec.DeepCopy().DNSConfig
-
-		// Set volume to access
-		if tContRuntime == contRuntimeContD {
-			cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
-				corev1.Volume{
-					Name: contRootContdVolume,
-					VolumeSource: corev1.VolumeSource{
-						HostPath: &corev1.HostPathVolumeSource{
-							Type: &cnsContRootVolumeType,
-							Path: contRootContdPath,
-						},
-					},
-				})
-
-			cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
-				corev1.VolumeMount{
-					Name:      contRootContdVolume,
-					MountPath: contRootContdPath,
-				})
-		} else if tContRuntime == contRuntimeCrio {
-			cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
-				corev1.Volume{
-					Name: contRootCrioVolume,
-					VolumeSource: corev1.VolumeSource{
-						HostPath: &corev1.HostPathVolumeSource{
-							Type: &cnsContRootVolumeType,
-							Path: contRootCrioPath,
-						},
-					},
-				})
-
-			cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
-				corev1.VolumeMount{
-					Name:      contRootCrioVolume,
-					MountPath: contRootCrioPath,
-				})
-		} else if tContRuntime == contRuntimeDocker {
-			cnsPod.Spec.Volumes = append(cnsPod.Spec.Volumes,
-				corev1.Volume{
-					Name: contRootDockerVolume,
-					VolumeSource: corev1.VolumeSource{
-						HostPath: &corev1.HostPathVolumeSource{
-							Type: &cnsContRootVolumeType,
-							Path: contRootDockerPath,
-						},
-					},
-				})
-
-			cnsPod.Spec.Containers[0].VolumeMounts = append(cnsPod.Spec.Containers[0].VolumeMounts,
-				corev1.VolumeMount{
-					Name:      contRootDockerVolume,
-					MountPath: contRootDockerPath,
-				})
-		} else {
-			return fmt.Errorf("%s is not supported container runtime", tContRuntime)
-		}
-	} else {
-		// For default mode
-		// Use default image
-		cnsPod.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", cnsContDefaultImg, strings.TrimPrefix(version, "v"))
-
-		// Set command
-		cnsPodCmd := []string{"cnsenter", "--runtime", tContRuntime, "--container", tContID,
-			"--mount", "--pid", "--net", "--ipc", "--uts", "--wd"}
-		if o.criSocket != "" {
-			cnsPodCmd = append(cnsPodCmd, "--cri", o.criSocket)
-		}
-		cnsPodCmd = append(cnsPodCmd, "--")
-		cnsPodCmd = append(cnsPodCmd, tPodCmd...)
-		cnsPod.Spec.Containers[0].Command = cnsPodCmd
+		tNode = getTargetNode(ctx, clientset, tPod)
 	}
 
-	// Set cnsenter pod's namespace and image
-	if o.cnsPodNamespace == "" {
-		o.cnsPodNamespace = o.tPodNs
+	// Build cnsenter pod
+	cnsPod, err := o.buildCnsPod(tPod, tNode, tContRuntime, tContID, tPodCmd)
+	if err != nil {
+		return err
 	}
-	if o.cnsPodImage != "" {
-		cnsPod.Spec.Containers[0].Image = o.cnsPodImage
+	return o.runCnsPod(ctx, restConfig, clientset, cnsPod, stdout, stderr)
+}
+
+// runNode runs the command in the host namespaces of the node
+func (o *Options) runNode(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, nodeName string,
+	cmd []string, stdout, stderr io.Writer) error {
+	// Check the node exists
+	err := retryOnTransientError(ctx, func() error {
+		_, getErr := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		return getErr
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get target node's info : %+v", err)
 	}
 
-	// Create a cnsenter pod
-	fmt.Printf("Create cnsenter pod (%s)\n", cnsPodName)
-	_, err = clientset.CoreV1().Pods(o.cnsPodNamespace).Create(context.TODO(), cnsPod, metav1.CreateOptions{})
+	// Build cnsenter pod
+	cnsPod, err := o.buildNodeCnsPod(nodeName, cmd)
 	if err != nil {
-		return fmt.Errorf("failed to create cnsetner pod (%s) : %+v", cnsPodName, err)
+		return err
 	}
-	defer func() {
-		// Delete cnsenter pod
-		fmt.Printf("Delete cnsenter pod (%s)\n", cnsPodName)
-		if err := clientset.CoreV1().Pods(o.cnsPodNamespace).Delete(context.TODO(), cnsPodName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Failed to delete to cnsenter pod (%s) : %+v\n", cnsPodName, err)
-		}
-	}()
+	return o.runCnsPod(ctx, restConfig, clientset, cnsPod, stdout, stderr)
+}
 
-	// Set signal handler to delete cnsenterpod
+// runCnsPod creates cnsenter pod, attaches it and deletes it. It returns cnsenter container's exit code as error
+func (o *Options) runCnsPod(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, cnsPod *corev1.Pod,
+	stdout, stderr io.Writer) error {
+	// Set context for this pod
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cnsPodName := cnsPod.Name
+
+	// Print cnsenter pod without creating it in dry run mode
+	// Server dry run sends the pod to API server to check admission
+	switch o.dryRun {
+	case dryRunClient:
+		return printCnsPod(stdout, cnsPod, o.output)
+	case dryRunServer:
+		var dryRunPod *corev1.Pod
+		err := retryOnTransientError(ctx, func() error {
+			var createErr error
+			dryRunPod, createErr = clientset.CoreV1().Pods(o.cnsPodNamespace).Create(ctx, cnsPod,
+				metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+			return createErr
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create cnsenter pod in dry run (%s) : %+v", cnsPodName, err)
+		}
+		return printCnsPod(stdout, dryRunPod, o.output)
+	}
+
+	// Set signal handler
+	// Forward the first signal to the command. If the command isn't terminated until
+	// the second signal or the grace timeout, cancel the context to delete cnsenter pod
+	// In TTY mode with stdin, stdin is passed through the pipe to write control characters of signals into it
+	var ttyStdin io.Writer
+	var attachTTYStdin io.Reader
+	if o.tty && o.stdin {
+		pipeReader, pipeWriter := io.Pipe()
+		attachTTYStdin, ttyStdin = pipeReader, pipeWriter
+		go func() {
+			io.Copy(pipeWriter, os.Stdin)
+			pipeWriter.Close()
+		}()
+	}
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
 	go func() {
-		sig := <-sigs
-		fmt.Printf("Recived signal %s\n", sig)
+		var sig os.Signal
+		select {
+		case sig = <-sigs:
+		case <-ctx.Done():
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Received signal %s\n", sig)
 
-		// Delete cnsenter pod and exit
-		fmt.Printf("Delete cnsenter pod (%s)\n", cnsPodName)
-		if err := clientset.CoreV1().Pods(o.cnsPodNamespace).Delete(context.TODO(), cnsPodName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Failed to delete to cnsenter pod (%s): %+v\n", cnsPodName, err)
+		// Forward signal to the command through the remote TTY or cnsenter
+		if err := o.forwardSignal(ctx, restConfig, clientset, cnsPodName, ttyStdin, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to forward signal %s to cnsenter pod (%s), so delete it : %+v\n", sig, cnsPodName, err)
+			if apierrors.IsForbidden(err) {
+				fmt.Fprintf(os.Stderr, "Forwarding signal needs pods/exec permission in namespace %s\n", o.cnsPodNamespace)
+			}
+		} else {
+			select {
+			case sig = <-sigs:
+				fmt.Fprintf(os.Stderr, "Received signal %s again\n", sig)
+			case <-time.After(time.Duration(o.signalGrace) * time.Second):
+				fmt.Fprintf(os.Stderr, "Command isn't terminated in %d seconds after signal\n", o.signalGrace)
+			case <-ctx.Done():
+				return
+			}
 		}
-		os.Exit(1)
+		cancel()
 	}()
 
-	// Wait cnsenter container to run
-	// Watch cnsenter pod
-	cnsPodWatch, err := clientset.CoreV1().Pods(o.cnsPodNamespace).
-		Watch(context.TODO(), metav1.ListOptions{Watch: true, FieldSelector: "metadata.name=" + cnsPodName})
+	// Set defer to delete cnsenter pod and create it
+	// All exit routes delete cnsenter pod through this defer. The defer is set before creating
+	// because API server can create the pod even if the context is canceled before the response
+	defer o.deleteCnsPod(clientset, cnsPodName)
+	fmt.Fprintf(os.Stderr, "Create cnsenter pod (%s)\n", cnsPodName)
+	created := false
+	err := retryOnTransientError(ctx, func() error {
+		_, err := clientset.CoreV1().Pods(o.cnsPodNamespace).Create(ctx, cnsPod, metav1.CreateOptions{})
+		// Previous request can be succeeded even if it returns a transient error
+		if created && apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		created = true
+		return err
+	})
 	if err != nil {
+		return fmt.Errorf("failed to create cnsenter pod (%s) : %+v", cnsPodName, err)
+	}
+
+	// Wait cnsenter container to run
+	// Watch cnsenter pod with wait timeout
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Duration(o.cnsPodTimeout)*time.Second)
+	defer waitCancel()
+	fmt.Fprintf(os.Stderr, "Wait to run cnsenter pod (%s)\n", cnsPodName)
+	cnsPod, err = o.waitCnsPodRunning(waitCtx, clientset, cnsPodName)
+	// Check canceled or timeout
+	if ctx.Err() != nil {
+		return fmt.Errorf("canceled to wait running cnsenter pod (%s)", cnsPodName)
+	} else if waitCtx.Err() != nil {
+		o.printCnsPodEvents(ctx, clientset, cnsPodName)
+		return fmt.Errorf("failed to wait running cnsenter pod (%s) : timeout", cnsPodName)
+	} else if err != nil {
 		return fmt.Errorf("failed to wait running cnsenter pod (%s) : %+v", cnsPodName, err)
 	}
-	// Set wait timeout
-	cnsPodTimer := time.NewTimer(time.Duration(o.cnsPodTimeout) * time.Second)
-	go func() {
-		<-cnsPodTimer.C
-		fmt.Printf("Failed to wait running cnsenter pod (%s)\n", cnsPodName)
 
-		// Print cnsenter pod's events
-		podEvents, err := clientset.CoreV1().Events(o.cnsPodNamespace).List(context.TODO(), metav1.ListOptions{
-			FieldSelector: fmt.Sprintf("involvedObject.namespace=%s,involvedObject.name=%s", o.cnsPodNamespace, cnsPodName),
-		})
-		if err != nil {
-			fmt.Printf("Failed to get cnsenter pod (%s) events : %+v\n", cnsPodName, err)
-		} else {
-			fmt.Printf("Print cnsenter pod (%s) events\n", cnsPodName)
-			fmt.Printf("---\n")
-			for _, event := range podEvents.Items {
-				fmt.Printf("%s\n", event.Message)
+	// Attach cnsenter pod
+	// In non-TTY mode, stdout and stderr are passed through separated streams
+	attached := false
+	if cnsPod.Status.Phase == corev1.PodRunning {
+		var attachStdin io.Reader
+		if !o.tty {
+			attachStdin = bytes.NewReader([]byte{cnsStdinSyncByte})
+			if o.stdin {
+				attachStdin = io.MultiReader(attachStdin, os.Stdin)
 			}
-			fmt.Printf("---\n")
+		} else if o.stdin {
+			attachStdin = attachTTYStdin
 		}
 
-		// Delete cnsenter pod and exit
-		fmt.Printf("Delete cnsenter pod (%s)\n", cnsPodName)
-		if err := clientset.CoreV1().Pods(o.cnsPodNamespace).Delete(context.TODO(), cnsPodName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Failed to delete to cnsenter pod (%s) : %+v\n", cnsPodName, err)
-		}
-		os.Exit(1)
-	}()
-	// Wait and check pod's status
-	fmt.Printf("Wait to run cnsenter pod (%s)\n", cnsPodName)
-	for cnsPodEvent := range cnsPodWatch.ResultChan() {
-		tPod, _ = cnsPodEvent.Object.(*corev1.Pod)
-		if tPod.Status.Phase == corev1.PodRunning || tPod.Status.Phase == corev1.PodSucceeded || tPod.Status.Phase == corev1.PodFailed {
-			break
+		var getErr error
+		err := attachPod(ctx, restConfig, clientset, o.cnsPodNamespace, cnsPodName, cnsContName, o.tty, attachStdin, stdout, stderr)
+		var codeErr utilexec.CodeExitError
+		if err == nil || errors.As(err, &codeErr) {
+			attached = true
+		} else if ctx.Err() != nil {
+			return fmt.Errorf("canceled to attach to cnsenter pod (%s)", cnsPodName)
+		} else {
+			// Check cnsenter pod terminated before attaching
+			// If cnsenter pod is terminated, get it's log
+			cnsPod, getErr = clientset.CoreV1().Pods(o.cnsPodNamespace).Get(ctx, cnsPodName, metav1.GetOptions{})
+			if getErr != nil || (cnsPod.Status.Phase != corev1.PodSucceeded && cnsPod.Status.Phase != corev1.PodFailed) {
+				return fmt.Errorf("failed to attach to cnsenter pod (%s) : %+v", cnsPodName, err)
+			}
 		}
 	}
-	// Stop timer and watch
-	cnsPodTimer.Stop()
-	cnsPodWatch.Stop()
 
-	// Attach cnsenter pod
-	if (o.tty || o.stdin) && tPod.Status.Phase == corev1.PodRunning {
-		if err := attachPod(o.kubeconfig, o.cnsPodNamespace, cnsPodName, "cnsenter", o.tty, o.stdin); err == nil {
-			return nil
+	if !attached {
+		// Get cnsenter pod's logs
+		cnsLogReq := clientset.CoreV1().Pods(o.cnsPodNamespace).GetLogs(cnsPodName, &corev1.PodLogOptions{Follow: true, Container: cnsContName})
+		cnsLog, err := cnsLogReq.Stream(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get cnsenter pod (%s) log stream : %+v", cnsPodName, err)
 		}
+		defer cnsLog.Close()
 
-		// Check cnsenter pod terminated through error
-		if !strings.Contains(err.Error(), "completed pod") {
-			return fmt.Errorf("failed to attach to cnsenter pod (%s) : %+v", cnsPodName, err)
+		// Print cnsenter pod's logs
+		for {
+			n, err := io.Copy(stdout, cnsLog)
+			if n == 0 || err == io.EOF {
+				break
+			}
+			if ctx.Err() != nil {
+				return fmt.Errorf("canceled to get cnsenter pod (%s) log", cnsPodName)
+			} else if err != nil {
+				return fmt.Errorf("failed to get cnsenter pod (%s) log : %+v", cnsPodName, err)
+			}
 		}
-		// If cnsenter pod is terminated, get it's log
 	}
 
-	// Get cnsenter pod's logs
-	cnsLogReq := clientset.CoreV1().Pods(o.cnsPodNamespace).GetLogs(cnsPodName, &corev1.PodLogOptions{Follow: true, Container: cnsContName})
-	cnsLog, err := cnsLogReq.Stream(context.TODO())
+	// Get cnsenter container's exit code
+	cnsContState, err := waitContainerTerminated(ctx, clientset, o.cnsPodNamespace, cnsPodName, cnsContName)
 	if err != nil {
-		return fmt.Errorf("failed to get cnsenter pod (%s) log stream : %+v", cnsPodName, err)
+		return fmt.Errorf("failed to get cnsenter container's exit code (%s) : %+v", cnsPodName, err)
+	}
+	if cnsContState.ExitCode != 0 {
+		return &ExitCodeError{Code: int(cnsContState.ExitCode), Reason: cnsContState.Reason}
 	}
-	defer cnsLog.Close()
+	return nil
+}
 
-	// Print cnsenter pod's logs
-	for {
-		n, err := io.Copy(os.Stdout, cnsLog)
-		if n == 0 || err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to get cnsenter pod (%s) log : %+v", cnsPodName, err)
-		}
+// forwardSignal forwards the signal to the command. The remote TTY gets the signal's control character through stdin,
+// and the other signals are sent by cnsenter which is run through pods/exec
+func (o *Options) forwardSignal(ctx context.Context, restConfig *rest.Config, clientset kubernetes.Interface, cnsPodName string,
+	ttyStdin io.Writer, sig os.Signal) error {
+	if ctrlChar, ok := signalCtrlChars[sig]; ok && ttyStdin != nil {
+		_, err := ttyStdin.Write([]byte{ctrlChar})
+		return err
 	}
+	return execPod(ctx, restConfig, clientset, o.cnsPodNamespace, cnsPodName, cnsContName,
+		[]string{"cnsenter", "--kill", signalNames[sig]})
+}
 
-	return nil
+// getTargetContainerName gets container name from container option. If the option is ambiguous, user selects
+// the container through picker in terminal
+func (o *Options) getTargetContainerName(tPod *corev1.Pod, interactive bool) (string, error) {
+	tContName, candidates, err := resolveContainerName(tPod, o.tContName)
+	if err != nil && len(candidates) > 0 && interactive {
+		return pickItem("Container", candidates)
+	} else if err != nil {
+		return "", err
+	}
+
+	// Print default container name
+	if o.tContName == "" {
+		fmt.Fprintf(os.Stderr, "Defaulting container name of %s to %s.\n", tPod.Name, tContName)
+	}
+	return tContName, nil
 }
 
-// Helpers
-func newClientset(kubeconfigPath string) (*kubernetes.Clientset, error) {
-	var clientsetConfig *rest.Config
-	var err error
+func (o *Options) deleteCnsPod(clientset kubernetes.Interface, cnsPodName string) {
+	// Use new context not to be affected by canceled context
+	ctx, cancel := context.WithTimeout(context.Background(), cnsPodDeleteTimeout*time.Second)
+	defer cancel()
 
-	if kubeconfigPath == "" {
-		// Get clientset config from env or default path (~/kube/.config)
-		clientCmdAPIConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get clientset config from env or default path : %+v", err)
-		}
-		clientsetConfig, err = clientcmd.NewDefaultClientConfig(*clientCmdAPIConfig, &clientcmd.ConfigOverrides{}).ClientConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get clientset config from env or default path : %+v", err)
+	// Delete cnsenter pod with retrying transient errors
+	fmt.Fprintf(os.Stderr, "Delete cnsenter pod (%s)\n", cnsPodName)
+	err := retryOnTransientError(ctx, func() error {
+		err := clientset.CoreV1().Pods(o.cnsPodNamespace).Delete(ctx, cnsPodName, metav1.DeleteOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
 		}
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete to cnsenter pod (%s) : %+v\n", cnsPodName, err)
+		return
+	}
 
-	} else {
-		// Get clientset config from kubeconfigPath
-		clientsetConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	// Wait cnsenter pod to be deleted
+	if o.waitDelete {
+		err := wait.PollImmediateWithContext(ctx, cnsPodDeleteInterval*time.Millisecond, cnsPodDeleteTimeout*time.Second, func(ctx context.Context) (bool, error) {
+			_, err := clientset.CoreV1().Pods(o.cnsPodNamespace).Get(ctx, cnsPodName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, nil
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to get config from kubeconfigPath : %+v", err)
+			fmt.Fprintf(os.Stderr, "Failed to wait cnsenter pod (%s) to be deleted : %+v\n", cnsPodName, err)
 		}
 	}
+}
+
+func (o *Options) printCnsPodEvents(ctx context.Context, clientset kubernetes.Interface, cnsPodName string) {
+	// Print cnsenter pod's events
+	podEvents, err := clientset.CoreV1().Events(o.cnsPodNamespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.namespace=%s,involvedObject.name=%s", o.cnsPodNamespace, cnsPodName),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get cnsenter pod (%s) events : %+v\n", cnsPodName, err)
+		return
+	}
 
-	// Get clientset from clientset config
-	clientset, err := kubernetes.NewForConfig(clientsetConfig)
+	fmt.Fprintf(os.Stderr, "Print cnsenter pod (%s) events\n", cnsPodName)
+	fmt.Fprintf(os.Stderr, "---\n")
+	for _, event := range podEvents.Items {
+		fmt.Fprintf(os.Stderr, "%s\n", event.Message)
+	}
+	fmt.Fprintf(os.Stderr, "---\n")
+}
+
+// Helpers
+func newClientset(restConfig *rest.Config) (*kubernetes.Clientset, error) {
+	// Get clientset from rest config
+	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get clientset : %+v", err)
 	}
 	return clientset, nil
 }
 
-func getNamespaceByKubeconfig(kubeconfigPath string) (string, error) {
-	var namespace string
+func getContainerRuntimeID(pod *corev1.Pod, containerName string) (string, string, error) {
+	status, err := getContainerStatus(pod, containerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Check container is running
+	if status.State.Waiting != nil {
+		return "", "", fmt.Errorf("container %s is waiting : %s %s", containerName,
+			status.State.Waiting.Reason, status.State.Waiting.Message)
+	} else if status.State.Terminated != nil {
+		return "", "", fmt.Errorf("container %s is terminated with exit code %d : %s %s", containerName,
+			status.State.Terminated.ExitCode, status.State.Terminated.Reason, status.State.Terminated.Message)
+	} else if status.State.Running == nil || status.ContainerID == "" {
+		return "", "", fmt.Errorf("container %s is not running", containerName)
+	}
 
-	if kubeconfigPath == "" {
-		// Get namespace from env or default path (~/kube/.config)
-		config, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
-		if err != nil {
-			return "", fmt.Errorf("failed to get namespace from env or default path : %+v", err)
+	u, err := url.Parse(status.ContainerID)
+	if err != nil {
+		return "", "", fmt.Errorf("parse container ID error")
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// getPodRuntime gets container runtime from any container's ID including terminated containers
+func getPodRuntime(pod *corev1.Pod) (string, error) {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses,
+		pod.Status.InitContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for _, status := range statuses {
+			if status.ContainerID == "" {
+				continue
+			}
+			u, err := url.Parse(status.ContainerID)
+			if err != nil {
+				return "", fmt.Errorf("parse container ID error")
+			}
+			return u.Scheme, nil
 		}
+	}
+	return "", fmt.Errorf("no container runtime info of pod %s", pod.Name)
+}
 
-		namespace = config.Contexts[config.CurrentContext].Namespace
-	} else {
-		// Get namespace config from kubeconfigPath
-		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
-			&clientcmd.ConfigOverrides{},
-		).RawConfig()
+func getContainerStatus(pod *corev1.Pod, containerName string) (*corev1.ContainerStatus, error) {
+	// Find container in containers, init containers (including sidecars) and ephemeral containers
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses,
+		pod.Status.InitContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for i := range statuses {
+			if statuses[i].Name == containerName {
+				return &statuses[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no container runtime, ID info of container %s", containerName)
+}
+
+func waitContainerTerminated(ctx context.Context, clientset kubernetes.Interface, podNs, podName, contName string) (*corev1.ContainerStateTerminated, error) {
+	var terminated *corev1.ContainerStateTerminated
+
+	// Container's status can be updated after stream is closed, so poll it for a while
+	err := wait.PollImmediateWithContext(ctx, cnsContTerminatedInterval*time.Millisecond, cnsContTerminatedTimeout*time.Second, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(podNs).Get(ctx, podName, metav1.GetOptions{})
 		if err != nil {
-			return "", fmt.Errorf("failed to get namespace from kubeconfigPath")
+			return false, err
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == contName && status.State.Terminated != nil {
+				terminated = status.State.Terminated
+				return true, nil
+			}
 		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return terminated, nil
+}
 
-		namespace = config.Contexts[config.CurrentContext].Namespace
+func getForwardEnvs(environ []string, termSize *remotecommand.TerminalSize) []string {
+	var envs []string
+
+	// Forward TERM, LANG and LC_*
+	termEnv := cnsDefaultTerm
+	for _, env := range environ {
+		key := strings.SplitN(env, "=", 2)[0]
+		if key == "TERM" {
+			if value := strings.TrimPrefix(env, "TERM="); value != "" {
+				termEnv = value
+			}
+		} else if key == "LANG" || strings.HasPrefix(key, "LC_") {
+			envs = append(envs, env)
+		}
 	}
+	envs = append([]string{"TERM=" + termEnv}, envs...)
 
-	// If namespace is empty string, set default namespace
-	if namespace == "" {
-		namespace = "default"
+	// Forward COLUMNS and LINES
+	// Terminal size has priority over envs
+	if termSize != nil {
+		envs = append(envs, fmt.Sprintf("COLUMNS=%d", termSize.Width), fmt.Sprintf("LINES=%d", termSize.Height))
+	} else {
+		for _, env := range environ {
+			if strings.HasPrefix(env, "COLUMNS=") || strings.HasPrefix(env, "LINES=") {
+				envs = append(envs, env)
+			}
+		}
 	}
-	return namespace, nil
+	return envs
 }
 
-func getContainerRuntimeID(pod *corev1.Pod, containerName string) (string, string, error) {
-	for _, status := range pod.Status.ContainerStatuses {
-		if status.Name == containerName {
-			u, err := url.Parse(status.ContainerID)
-			if err != nil {
-				return "", "", fmt.Errorf("parse container ID error")
+func mergeEnvs(envs, overrides []string) []string {
+	var result []string
+
+	// Drop envs overridden by the same key
+	for _, env := range envs {
+		key := strings.SplitN(env, "=", 2)[0]
+		overridden := false
+		for _, override := range overrides {
+			if strings.SplitN(override, "=", 2)[0] == key {
+				overridden = true
+				break
 			}
-			return u.Scheme, u.Host, nil
+		}
+		if !overridden {
+			result = append(result, env)
 		}
 	}
-
-	return "", "", fmt.Errorf("no container runtime, ID info")
+	return append(result, overrides...)
 }
 
 func getRandomString(n int) string {
@@ -666,25 +1009,3 @@ func getRandomString(n int) string {
 	}
 	return string(s)
 }
-
-func attachPod(kubeconfig, podNs, podName, contName string, tty, stdin bool) error {
-	// Set kubectl attach args
-	args := []string{"--kubeconfig", kubeconfig, "attach", "--namespace", podNs, podName, "--container", contName}
-	if tty {
-		args = append(args, "--tty")
-	}
-	if stdin {
-		args = append(args, "--stdin")
-	}
-
-	// Run kubectl attach
-	cmd := exec.Command("kubectl", args...)
-	cmd.Env = os.Environ()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,218 @@
+package kpexec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+func TestGetForwardEnvs(t *testing.T) {
+	environ := []string{"HOME=/root", "TERM=screen-256color", "LANG=en_US.UTF-8", "LC_ALL=C", "COLUMNS=80", "LINES=24"}
+
+	// Get envs from environ
+	envs := getForwardEnvs(environ, nil)
+	expected := []string{"TERM=screen-256color", "LANG=en_US.UTF-8", "LC_ALL=C", "COLUMNS=80", "LINES=24"}
+	if !reflect.DeepEqual(envs, expected) {
+		t.Fatalf("envs %v is not expected %v", envs, expected)
+	}
+
+	// Get envs with terminal size and without TERM
+	envs = getForwardEnvs([]string{"LINES=24"}, &remotecommand.TerminalSize{Width: 120, Height: 40})
+	expected = []string{"TERM=xterm", "COLUMNS=120", "LINES=40"}
+	if !reflect.DeepEqual(envs, expected) {
+		t.Fatalf("envs %v is not expected %v", envs, expected)
+	}
+}
+
+func TestMergeEnvs(t *testing.T) {
+	envs := mergeEnvs([]string{"TERM=xterm", "LANG=C"}, []string{"TERM=vt100", "FOO=bar"})
+	expected := []string{"LANG=C", "TERM=vt100", "FOO=bar"}
+	if !reflect.DeepEqual(envs, expected) {
+		t.Fatalf("envs %v is not expected %v", envs, expected)
+	}
+}
+
+func TestGetContainerRuntimeID(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://app", State: running},
+				{Name: "crash", ContainerID: "containerd://crash", State: corev1.ContainerState{
+					Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "sidecar", ContainerID: "cri-o://sidecar", State: running},
+				{Name: "init", ContainerID: "containerd://init", State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}},
+			},
+			EphemeralContainerStatuses: []corev1.ContainerStatus{
+				{Name: "debug", ContainerID: "docker://debug", State: running},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		runtime string
+		id      string
+		err     bool
+	}{
+		{"app", "containerd", "app", false},
+		{"sidecar", "cri-o", "sidecar", false},
+		{"debug", "docker", "debug", false},
+		{"crash", "", "", true},
+		{"init", "", "", true},
+		{"none", "", "", true},
+	}
+
+	for _, test := range tests {
+		runtime, id, err := getContainerRuntimeID(pod, test.name)
+		if runtime != test.runtime || id != test.id || (err != nil) != test.err {
+			t.Fatalf("%s : runtime %s, id %s, err %v is not expected", test.name, runtime, id, err)
+		}
+	}
+}
+
+// newTestLifecyclePod returns cnsenter pod for testing its lifecycle
+func newTestLifecyclePod() *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cnsenter-test", Namespace: "debug", ResourceVersion: "1"}}
+}
+
+func TestForwardSignalThroughTTY(t *testing.T) {
+	// SIGINT and SIGQUIT are written to the remote TTY as control characters without pods/exec
+	o := &Options{cnsPodNamespace: "debug"}
+	var ttyStdin bytes.Buffer
+	for _, sig := range []syscall.Signal{syscall.SIGINT, syscall.SIGQUIT} {
+		if err := o.forwardSignal(context.Background(), nil, nil, "cnsenter-test", &ttyStdin, sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(ttyStdin.Bytes(), []byte{0x03, 0x1c}) {
+		t.Fatalf("control characters %q are not expected", ttyStdin.Bytes())
+	}
+}
+
+func TestDeleteCnsPodRetry(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newTestLifecyclePod())
+
+	// The first delete fails with a transient error
+	deletes := 0
+	clientset.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deletes++
+		if deletes == 1 {
+			return true, nil, apierrors.NewServiceUnavailable("unavailable")
+		}
+		return false, nil, nil
+	})
+
+	o := &Options{cnsPodNamespace: "debug"}
+	o.deleteCnsPod(clientset, "cnsenter-test")
+	if _, err := clientset.CoreV1().Pods("debug").Get(context.Background(), "cnsenter-test", metav1.GetOptions{}); !apierrors.IsNotFound(err) || deletes != 2 {
+		t.Fatalf("cnsenter pod isn't deleted with retry : %v, %d deletes", err, deletes)
+	}
+
+	// Already deleted pod is ignored
+	o.deleteCnsPod(clientset, "cnsenter-test")
+}
+
+func TestDeleteCnsPodWaitDelete(t *testing.T) {
+	for _, waitDelete := range []bool{false, true} {
+		clientset := fake.NewSimpleClientset(newTestLifecyclePod())
+
+		// Pod is terminating until the third get after delete
+		gets := 0
+		clientset.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, nil
+		})
+		clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			gets++
+			if gets < 3 {
+				return true, newTestLifecyclePod(), nil
+			}
+			return true, nil, apierrors.NewNotFound(corev1.Resource("pods"), "cnsenter-test")
+		})
+
+		o := &Options{cnsPodNamespace: "debug", waitDelete: waitDelete}
+		o.deleteCnsPod(clientset, "cnsenter-test")
+		if (waitDelete && gets != 3) || (!waitDelete && gets != 0) {
+			t.Fatalf("%d gets with wait delete %t are not expected", gets, waitDelete)
+		}
+	}
+}
+
+func TestRunCnsPodCanceled(t *testing.T) {
+	o := &Options{cnsPodNamespace: "debug", cnsPodTimeout: 60, signalGrace: 1}
+	podGVR := corev1.SchemeGroupVersion.WithResource("pods")
+
+	// API server creates the pod, but the context is canceled before the response
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		createAction := action.(k8stesting.CreateAction)
+		if err := clientset.Tracker().Create(podGVR, createAction.GetObject(), createAction.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		return true, nil, context.Canceled
+	})
+	if err := o.runCnsPod(context.Background(), nil, clientset, newTestLifecyclePod(), io.Discard, io.Discard); err == nil {
+		t.Fatalf("canceled creation succeeds")
+	}
+	if _, err := clientset.CoreV1().Pods("debug").Get(context.Background(), "cnsenter-test", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("cnsenter pod remains after canceled creation : %v", err)
+	}
+
+	// Context is canceled while waiting cnsenter pod to run
+	clientset = fake.NewSimpleClientset()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := o.runCnsPod(ctx, nil, clientset, newTestLifecyclePod(), io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("error %v is not expected", err)
+	}
+	if _, err := clientset.CoreV1().Pods("debug").Get(context.Background(), "cnsenter-test", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("cnsenter pod remains after canceled wait : %v", err)
+	}
+}
+
+func TestDeleteNotRunningCnsPods(t *testing.T) {
+	newCnsPod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "debug", Labels: map[string]string{cnsPodLabelKey: cnsPodLabelValue}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	o := &Options{}
+
+	// Canceled garbage collector doesn't delete cnsenter pods
+	clientset := fake.NewSimpleClientset(newCnsPod("cnsenter-running", corev1.PodRunning), newCnsPod("cnsenter-done", corev1.PodSucceeded))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := o.deleteNotRunningCnsPods(ctx, clientset); err == nil {
+		t.Fatalf("canceled garbage collector isn't stopped")
+	}
+	if _, err := clientset.CoreV1().Pods("debug").Get(context.Background(), "cnsenter-done", metav1.GetOptions{}); err != nil {
+		t.Fatalf("cnsenter pod is deleted by canceled garbage collector : %v", err)
+	}
+
+	// Only not running cnsenter pods are deleted
+	if err := o.deleteNotRunningCnsPods(context.Background(), clientset); err != nil {
+		t.Fatal(err)
+	}
+	pods, err := clientset.CoreV1().Pods("debug").List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(pods.Items) != 1 || pods.Items[0].Name != "cnsenter-running" {
+		t.Fatalf("cnsenter pods %+v are not expected : %v", pods, err)
+	}
+}
@@ -0,0 +1,74 @@
+package kpexec
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	contRootContdK3sPath      = "/run/k3s/containerd"
+	contRootContdMicroK8sPath = "/var/snap/microk8s/common/run/containerd"
+
+	nodeAnnotationK3sArgs  = "k3s.io/node-args"
+	nodeAnnotationRKE2Args = "rke2.io/node-args"
+	nodeLabelMicroK8s      = "microk8s.io/cluster"
+	nodeVersionK3s         = "+k3s"
+	nodeVersionRKE2        = "+rke2"
+)
+
+var (
+	// Known containerd's sockets and their state paths. Unknown socket's state path is the socket's dir
+	contRootContdSocketPaths = map[string]string{
+		"/run/containerd/containerd.sock":               contRootContdPath,
+		"/run/k3s/containerd/containerd.sock":           contRootContdK3sPath,
+		"/var/snap/microk8s/common/run/containerd.sock": contRootContdMicroK8sPath,
+	}
+)
+
+// getTargetNode gets the target pod's node. If the node can't be got like no permission, it returns nil
+func getTargetNode(ctx context.Context, clientset kubernetes.Interface, tPod *corev1.Pod) *corev1.Node {
+	var node *corev1.Node
+	err := retryOnTransientError(ctx, func() error {
+		var getErr error
+		node, getErr = clientset.CoreV1().Nodes().Get(ctx, tPod.Spec.NodeName, metav1.GetOptions{})
+		return getErr
+	})
+	if err != nil {
+		return nil
+	}
+	return node
+}
+
+// getContdRootPath gets containerd's state path on the node by the node's distribution. k3s and RKE2 run
+// k3s's containerd, MicroK8s runs snap's containerd and the others including kind use the default path
+func getContdRootPath(node *corev1.Node) string {
+	if node == nil {
+		return contRootContdPath
+	}
+
+	_, k3s := node.Annotations[nodeAnnotationK3sArgs]
+	_, rke2 := node.Annotations[nodeAnnotationRKE2Args]
+	_, microK8s := node.Labels[nodeLabelMicroK8s]
+	kubeletVersion := node.Status.NodeInfo.KubeletVersion
+	switch {
+	case k3s, rke2, strings.Contains(kubeletVersion, nodeVersionK3s), strings.Contains(kubeletVersion, nodeVersionRKE2):
+		return contRootContdK3sPath
+	case microK8s:
+		return contRootContdMicroK8sPath
+	}
+	return contRootContdPath
+}
+
+// getContdRootPathOfSocket gets containerd's state path on the node by containerd's socket path like cnsenter does
+func getContdRootPathOfSocket(socketPath string) string {
+	socketPath = strings.TrimPrefix(socketPath, "unix://")
+	if path, ok := contRootContdSocketPaths[socketPath]; ok {
+		return path
+	}
+	return filepath.Dir(socketPath)
+}
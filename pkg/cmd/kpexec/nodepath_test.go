@@ -0,0 +1,46 @@
+package kpexec
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetContdRootPath(t *testing.T) {
+	tests := []struct {
+		node     *corev1.Node
+		expected string
+	}{
+		{nil, contRootContdPath},
+		{&corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: "v1.25.3"}}}, contRootContdPath},
+		{&corev1.Node{Spec: corev1.NodeSpec{ProviderID: "kind://docker/kind/kind-control-plane"}}, contRootContdPath},
+		{&corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: "v1.25.3+k3s1"}}}, contRootContdK3sPath},
+		{&corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{nodeAnnotationRKE2Args: "[]"}}}, contRootContdK3sPath},
+		{&corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{nodeLabelMicroK8s: "true"}}}, contRootContdMicroK8sPath},
+	}
+
+	for _, test := range tests {
+		if path := getContdRootPath(test.node); path != test.expected {
+			t.Fatalf("path %s of node %+v is not expected %s", path, test.node, test.expected)
+		}
+	}
+}
+
+func TestGetContdRootPathOfSocket(t *testing.T) {
+	tests := []struct {
+		socketPath string
+		expected   string
+	}{
+		{"/run/containerd/containerd.sock", contRootContdPath},
+		{"unix:///run/k3s/containerd/containerd.sock", contRootContdK3sPath},
+		{"/var/snap/microk8s/common/run/containerd.sock", contRootContdMicroK8sPath},
+		{"/data/containerd/containerd.sock", "/data/containerd"},
+	}
+
+	for _, test := range tests {
+		if path := getContdRootPathOfSocket(test.socketPath); path != test.expected {
+			t.Fatalf("path %s of socket %s is not expected %s", path, test.socketPath, test.expected)
+		}
+	}
+}
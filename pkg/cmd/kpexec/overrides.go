@@ -0,0 +1,175 @@
+package kpexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// Pull policies of cnsenter container
+	pullPolicies = map[string]corev1.PullPolicy{
+		string(corev1.PullAlways):       corev1.PullAlways,
+		string(corev1.PullIfNotPresent): corev1.PullIfNotPresent,
+		string(corev1.PullNever):        corev1.PullNever,
+	}
+)
+
+// customizeCnsPod applies shortcut flags and then overrides patch to cnsenter pod.
+// cnsenter pod's name, namespace, label and container name are kept for attach and garbage collector
+func (o *Options) customizeCnsPod(cnsPod *corev1.Pod) (*corev1.Pod, error) {
+	// Set pull secrets and pull policy
+	for _, secret := range o.cnsPodPullSecrets {
+		cnsPod.Spec.ImagePullSecrets = append(cnsPod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secret})
+	}
+	if o.cnsPodPullPolicy != "" {
+		pullPolicy, ok := pullPolicies[o.cnsPodPullPolicy]
+		if !ok {
+			return nil, fmt.Errorf("%s is not supported pull policy", o.cnsPodPullPolicy)
+		}
+		cnsPod.Spec.Containers[0].ImagePullPolicy = pullPolicy
+	}
+
+	// Set labels and annotations
+	labels, err := parseKeyValues(o.cnsPodLabels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse labels : %+v", err)
+	}
+	for key, value := range labels {
+		cnsPod.Labels[key] = value
+	}
+	annotations, err := parseKeyValues(o.cnsPodAnnotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotations : %+v", err)
+	}
+	if len(annotations) > 0 && cnsPod.Annotations == nil {
+		cnsPod.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		cnsPod.Annotations[key] = value
+	}
+
+	// Set resources
+	if cnsPod.Spec.Containers[0].Resources.Requests, err = parseResourceList(o.cnsPodRequests); err != nil {
+		return nil, fmt.Errorf("failed to parse resource requests : %+v", err)
+	}
+	if cnsPod.Spec.Containers[0].Resources.Limits, err = parseResourceList(o.cnsPodLimits); err != nil {
+		return nil, fmt.Errorf("failed to parse resource limits : %+v", err)
+	}
+
+	// Apply overrides patch
+	if o.cnsPodOverrides == "" {
+		return cnsPod, nil
+	}
+	patch, err := getOverridesPatch(o.cnsPodOverrides)
+	if err != nil {
+		return nil, err
+	}
+	patchedPod, err := patchPod(cnsPod, patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply overrides : %+v", err)
+	}
+	if len(patchedPod.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("overrides remove cnsenter container")
+	}
+	patchedPod.Name = cnsPod.Name
+	patchedPod.Namespace = cnsPod.Namespace
+	patchedPod.Spec.Containers[0].Name = cnsContName
+	if patchedPod.Labels == nil {
+		patchedPod.Labels = map[string]string{}
+	}
+	patchedPod.Labels[cnsPodLabelKey] = cnsPodLabelValue
+	return patchedPod, nil
+}
+
+// getOverridesPatch gets JSON patch from inline JSON or JSON/YAML file
+func getOverridesPatch(overrides string) ([]byte, error) {
+	data := []byte(overrides)
+	trimmed := strings.TrimSpace(overrides)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		var err error
+		data, err = os.ReadFile(overrides)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read overrides file : %+v", err)
+		}
+	}
+
+	patch, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse overrides : %+v", err)
+	}
+	return patch, nil
+}
+
+// patchPod applies JSON patch if patch is an array, or strategic merge patch if patch is an object
+func patchPod(pod *corev1.Pod, patch []byte) (*corev1.Pod, error) {
+	podJSON, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	var patchedJSON []byte
+	if bytes.HasPrefix(bytes.TrimSpace(patch), []byte("[")) {
+		jsonPatch, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		patchedJSON, err = jsonPatch.Apply(podJSON)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		patchedJSON, err = strategicpatch.StrategicMergePatch(podJSON, patch, corev1.Pod{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	patchedPod := &corev1.Pod{}
+	if err := json.Unmarshal(patchedJSON, patchedPod); err != nil {
+		return nil, err
+	}
+	return patchedPod, nil
+}
+
+// parseKeyValues parses KEY=VALUE list
+func parseKeyValues(keyValues []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, keyValue := range keyValues {
+		parts := strings.SplitN(keyValue, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%s is not KEY=VALUE", keyValue)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// parseResourceList parses resource list like cpu=100m,memory=64Mi
+func parseResourceList(resources string) (corev1.ResourceList, error) {
+	if resources == "" {
+		return nil, nil
+	}
+
+	result := corev1.ResourceList{}
+	for _, keyValue := range strings.Split(resources, ",") {
+		parts := strings.SplitN(keyValue, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%s is not NAME=QUANTITY", keyValue)
+		}
+		quantity, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s is wrong quantity : %+v", parts[1], err)
+		}
+		result[corev1.ResourceName(parts[0])] = quantity
+	}
+	return result, nil
+}
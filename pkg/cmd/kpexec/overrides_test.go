@@ -0,0 +1,83 @@
+package kpexec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestCnsPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cnsenter-test",
+			Labels: map[string]string{cnsPodLabelKey: cnsPodLabelValue},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: cnsContName, Image: "ssup2/cnsenter:latest"}},
+		},
+	}
+}
+
+func TestCustomizeCnsPodShortcuts(t *testing.T) {
+	o := &Options{
+		cnsPodPullSecrets: []string{"regcred"},
+		cnsPodPullPolicy:  "Always",
+		cnsPodLabels:      []string{"team=sre"},
+		cnsPodAnnotations: []string{"policy/exempt=true"},
+		cnsPodRequests:    "cpu=100m,memory=64Mi",
+		cnsPodLimits:      "memory=256Mi",
+	}
+	pod, err := o.customizeCnsPod(newTestCnsPod())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cont := pod.Spec.Containers[0]
+	if pod.Spec.ImagePullSecrets[0].Name != "regcred" || cont.ImagePullPolicy != corev1.PullAlways ||
+		pod.Labels["team"] != "sre" || pod.Labels[cnsPodLabelKey] != cnsPodLabelValue ||
+		pod.Annotations["policy/exempt"] != "true" ||
+		cont.Resources.Requests.Cpu().String() != "100m" || cont.Resources.Limits.Memory().String() != "256Mi" {
+		t.Fatalf("pod %+v is not expected", pod)
+	}
+
+	// Wrong shortcut values
+	for _, o := range []*Options{{cnsPodPullPolicy: "Sometimes"}, {cnsPodLabels: []string{"team"}}, {cnsPodRequests: "cpu=lots"}} {
+		if _, err := o.customizeCnsPod(newTestCnsPod()); err == nil {
+			t.Fatalf("options %+v are allowed", o)
+		}
+	}
+}
+
+func TestCustomizeCnsPodOverrides(t *testing.T) {
+	// Strategic merge patch keeps cnsenter container and its image
+	o := &Options{cnsPodOverrides: `{"metadata":{"name":"other","labels":null},"spec":{"priorityClassName":"system-node-critical",` +
+		`"containers":[{"name":"cnsenter","env":[{"name":"FOO","value":"bar"}]}]}}`}
+	pod, err := o.customizeCnsPod(newTestCnsPod())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name != "cnsenter-test" || pod.Labels[cnsPodLabelKey] != cnsPodLabelValue || pod.Spec.PriorityClassName != "system-node-critical" ||
+		len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Image != "ssup2/cnsenter:latest" || pod.Spec.Containers[0].Env[0].Value != "bar" {
+		t.Fatalf("pod %+v is not expected", pod)
+	}
+
+	// JSON patch from YAML file
+	path := filepath.Join(t.TempDir(), "overrides.yaml")
+	patch := "- op: add\n  path: /spec/serviceAccountName\n  value: debugger\n"
+	if err := os.WriteFile(path, []byte(patch), 0600); err != nil {
+		t.Fatal(err)
+	}
+	o = &Options{cnsPodOverrides: path}
+	if pod, err = o.customizeCnsPod(newTestCnsPod()); err != nil || pod.Spec.ServiceAccountName != "debugger" {
+		t.Fatalf("pod %+v, err %v is not expected", pod, err)
+	}
+
+	// Wrong patch
+	o = &Options{cnsPodOverrides: `[{"op":"remove","path":"/spec/none"}]`}
+	if _, err := o.customizeCnsPod(newTestCnsPod()); err == nil {
+		t.Fatalf("wrong patch is applied")
+	}
+}
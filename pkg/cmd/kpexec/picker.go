@@ -0,0 +1,163 @@
+package kpexec
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	pickerMaxLines = 10
+
+	keyCtrlC     = 3
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyEnter     = 13
+	keyNewline   = 10
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// isInteractive returns true if user can select items through terminal
+func isInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// pickItem shows fuzzy picker of items on stderr and returns the selected item
+func pickItem(title string, items []string) (string, error) {
+	if len(items) == 0 {
+		return "", fmt.Errorf("no items to select")
+	}
+
+	// Switch to raw terminal mode to read each key
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to set raw terminal mode : %+v", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	reader := bufio.NewReader(os.Stdin)
+	query := ""
+	cursor := 0
+	drawnLines := 0
+	defer func() { clearPicker(drawnLines) }()
+
+	for {
+		// Filter items and draw picker
+		matched := filterFuzzy(items, query)
+		if cursor >= len(matched) {
+			cursor = len(matched) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+		drawnLines = drawPicker(drawnLines, title, query, matched, len(items), cursor)
+
+		// Handle key
+		key, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case keyCtrlC:
+			return "", fmt.Errorf("selection is canceled")
+		case keyEnter, keyNewline:
+			if len(matched) > 0 {
+				return matched[cursor], nil
+			}
+		case keyBackspace, keyCtrlH:
+			if len(query) > 0 {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+			}
+		case keyCtrlP:
+			cursor--
+		case keyCtrlN:
+			cursor++
+		case keyEscape:
+			// Escape key only cancels. Arrow keys are escape sequences
+			if reader.Buffered() == 0 {
+				return "", fmt.Errorf("selection is canceled")
+			}
+			seq := make([]byte, 2)
+			if _, err := reader.Read(seq); err != nil {
+				return "", err
+			}
+			if seq[0] == '[' && seq[1] == 'A' {
+				cursor--
+			} else if seq[0] == '[' && seq[1] == 'B' {
+				cursor++
+			}
+		default:
+			if key >= 32 {
+				query += string(key)
+				cursor = 0
+			}
+		}
+	}
+}
+
+func drawPicker(prevLines int, title, query string, matched []string, total, cursor int) int {
+	clearPicker(prevLines)
+
+	// Show items around cursor
+	start := 0
+	if cursor >= pickerMaxLines {
+		start = cursor - pickerMaxLines + 1
+	}
+	end := start + pickerMaxLines
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		if i == cursor {
+			fmt.Fprintf(&b, "> %s\r\n", matched[i])
+		} else {
+			fmt.Fprintf(&b, "  %s\r\n", matched[i])
+		}
+	}
+	fmt.Fprintf(&b, "  %d/%d\r\n", len(matched), total)
+	fmt.Fprintf(&b, "%s > %s", title, query)
+	fmt.Fprint(os.Stderr, b.String())
+	return end - start + 1
+}
+
+func clearPicker(lines int) {
+	// Move to the first line of the picker and clear to the end of screen
+	if lines > 0 {
+		fmt.Fprintf(os.Stderr, "\r\033[%dA\033[J", lines)
+	} else {
+		fmt.Fprint(os.Stderr, "\r\033[J")
+	}
+}
+
+// filterFuzzy returns items which have all characters of query in order
+func filterFuzzy(items []string, query string) []string {
+	var matched []string
+	for _, item := range items {
+		if fuzzyMatch(item, query) {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
+
+func fuzzyMatch(s, query string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package kpexec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterFuzzy(t *testing.T) {
+	items := []string{"api-7d9f/app", "api-7d9f/istio-proxy", "web-5c4b/nginx"}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", items},
+		{"api", []string{"api-7d9f/app", "api-7d9f/istio-proxy"}},
+		{"APX", []string{"api-7d9f/istio-proxy"}},
+		{"wng", []string{"web-5c4b/nginx"}},
+		{"xyz", nil},
+	}
+
+	for _, test := range tests {
+		matched := filterFuzzy(items, test.query)
+		if !reflect.DeepEqual(matched, test.expected) {
+			t.Fatalf("%s : matched %v is not expected %v", test.query, matched, test.expected)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package kpexec
+
+import (
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// termSizeQueue implements remotecommand.TerminalSizeQueue
+type termSizeQueue struct {
+	fd    int
+	sizes chan remotecommand.TerminalSize
+	stop  chan struct{}
+}
+
+func newTermSizeQueue(fd int) *termSizeQueue {
+	q := &termSizeQueue{
+		fd:    fd,
+		sizes: make(chan remotecommand.TerminalSize, 1),
+		stop:  make(chan struct{}),
+	}
+
+	// Send initial size and monitor resize
+	q.push()
+	go q.monitor()
+	return q
+}
+
+func (q *termSizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-q.sizes:
+		return &size
+	case <-q.stop:
+		return nil
+	}
+}
+
+func (q *termSizeQueue) Stop() {
+	close(q.stop)
+}
+
+func (q *termSizeQueue) push() {
+	size := getTermSize(q.fd)
+	if size == nil {
+		return
+	}
+
+	// Replace the pending size with the latest one
+	select {
+	case <-q.sizes:
+	default:
+	}
+	q.sizes <- *size
+}
+
+// Helpers
+func getTermSize(fd int) *remotecommand.TerminalSize {
+	width, height, err := term.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		return nil
+	}
+	return &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package kpexec
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func (q *termSizeQueue) monitor() {
+	// Get resize events through SIGWINCH
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	for {
+		select {
+		case <-winch:
+			q.push()
+		case <-q.stop:
+			return
+		}
+	}
+}
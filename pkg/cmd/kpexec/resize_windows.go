@@ -0,0 +1,29 @@
+package kpexec
+
+import (
+	"time"
+)
+
+const (
+	termSizePollInterval = 250
+)
+
+func (q *termSizeQueue) monitor() {
+	// Windows doesn't have SIGWINCH, so poll terminal size
+	ticker := time.NewTicker(termSizePollInterval * time.Millisecond)
+	defer ticker.Stop()
+
+	last := getTermSize(q.fd)
+	for {
+		select {
+		case <-ticker.C:
+			size := getTermSize(q.fd)
+			if size != nil && (last == nil || *size != *last) {
+				last = size
+				q.push()
+			}
+		case <-q.stop:
+			return
+		}
+	}
+}
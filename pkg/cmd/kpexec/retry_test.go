@@ -0,0 +1,50 @@
+package kpexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRetryOnTransientError(t *testing.T) {
+	podResource := schema.GroupResource{Resource: "pods"}
+
+	// Shorten backoff for test
+	backoff := retryBackoff
+	retryBackoff.Duration = time.Millisecond
+	defer func() { retryBackoff = backoff }()
+
+	// Retry transient errors until success
+	count := 0
+	err := retryOnTransientError(context.Background(), func() error {
+		count++
+		if count < 3 {
+			return apierrors.NewTooManyRequests("too many requests", 0)
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Fatalf("err %v, count %d is not expected", err, count)
+	}
+
+	// Don't retry permanent errors
+	count = 0
+	err = retryOnTransientError(context.Background(), func() error {
+		count++
+		return apierrors.NewNotFound(podResource, "test")
+	})
+	if !apierrors.IsNotFound(err) || count != 1 {
+		t.Fatalf("err %v, count %d is not expected", err, count)
+	}
+
+	// Return last error if retry is exhausted
+	err = retryOnTransientError(context.Background(), func() error {
+		return apierrors.NewServiceUnavailable("unavailable")
+	})
+	if !apierrors.IsServiceUnavailable(err) {
+		t.Fatalf("err %v is not expected", err)
+	}
+}
@@ -0,0 +1,467 @@
+package kpexec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	targetTypePod         = "pod"
+	targetTypeDeployment  = "deployment"
+	targetTypeStatefulSet = "statefulset"
+	targetTypeDaemonSet   = "daemonset"
+	targetTypeReplicaSet  = "replicaset"
+	targetTypeJob         = "job"
+	targetTypeService     = "service"
+	targetTypeNode        = "node"
+
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+)
+
+var (
+	// Target types and their aliases like kubectl
+	targetTypeAliases = map[string]string{
+		"po": targetTypePod, "pod": targetTypePod, "pods": targetTypePod,
+		"deploy": targetTypeDeployment, "deployment": targetTypeDeployment, "deployments": targetTypeDeployment,
+		"sts": targetTypeStatefulSet, "statefulset": targetTypeStatefulSet, "statefulsets": targetTypeStatefulSet,
+		"ds": targetTypeDaemonSet, "daemonset": targetTypeDaemonSet, "daemonsets": targetTypeDaemonSet,
+		"rs": targetTypeReplicaSet, "replicaset": targetTypeReplicaSet, "replicasets": targetTypeReplicaSet,
+		"job": targetTypeJob, "jobs": targetTypeJob,
+		"svc": targetTypeService, "service": targetTypeService, "services": targetTypeService,
+		"no": targetTypeNode, "node": targetTypeNode, "nodes": targetTypeNode,
+	}
+)
+
+// parseArgs gets target and command from args. Double dash can be omitted if the command follows the target.
+// If target is omitted before double dash or hasTarget is false, all args are the command
+func parseArgs(args []string, argsLenAtDash int, hasTarget bool) (string, []string, error) {
+	if !hasTarget {
+		if argsLenAtDash > 0 {
+			return "", nil, fmt.Errorf("target can't be used with selector")
+		} else if len(args) == 0 {
+			return "", nil, fmt.Errorf("no commands")
+		}
+		return "", args, nil
+	}
+
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("no target")
+	} else if argsLenAtDash == 0 {
+		return "", args, nil
+	} else if argsLenAtDash >= 2 {
+		return "", nil, fmt.Errorf("wrong target")
+	}
+	if len(args) <= 1 {
+		return "", nil, fmt.Errorf("no commands")
+	}
+	return args[0], args[1:], nil
+}
+
+// parseTarget gets target's type and name from TYPE/NAME. If TYPE is omitted, target is pod
+func parseTarget(target string) (string, string, error) {
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) == 1 {
+		return targetTypePod, parts[0], nil
+	}
+
+	targetType, ok := targetTypeAliases[strings.ToLower(parts[0])]
+	if !ok {
+		return "", "", fmt.Errorf("%s is not supported target type", parts[0])
+	}
+	if parts[1] == "" {
+		return "", "", fmt.Errorf("no target name")
+	}
+	return targetType, parts[1], nil
+}
+
+// resolveTargetPod gets a pod from target. For workloads, it returns a ready pod selected by the workload
+func resolveTargetPod(ctx context.Context, clientset kubernetes.Interface, namespace, target string) (*corev1.Pod, error) {
+	targetType, targetName, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch targetType {
+	case targetTypePod:
+		var pod *corev1.Pod
+		err := retryOnTransientError(ctx, func() error {
+			var getErr error
+			pod, getErr = clientset.CoreV1().Pods(namespace).Get(ctx, targetName, metav1.GetOptions{})
+			return getErr
+		})
+		return pod, err
+
+	case targetTypeService:
+		// Get a pod from service's endpoints first
+		pod, err := getPodFromEndpoints(ctx, clientset, namespace, targetName)
+		if err != nil || pod != nil {
+			return pod, err
+		}
+	}
+
+	// Get a ready pod through selector
+	selector, err := getTargetSelector(ctx, clientset, namespace, targetType, targetName)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := getPodsBySelector(ctx, clientset, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pod of %s", target)
+	}
+	sortPodsByReady(pods)
+	fmt.Fprintf(os.Stderr, "Selected pod %s of %s.\n", pods[0].Name, target)
+	return &pods[0], nil
+}
+
+// selectTargetPod gets a pod from target. If target is omitted or pod isn't found, user selects the pod and its
+// container through picker. Only the unique pod of the name's prefix is selected without picker because fuzzy
+// matched pod can be unrelated. If not interactive, it returns candidates with error
+func (o *Options) selectTargetPod(ctx context.Context, clientset kubernetes.Interface, target string, interactive bool) (*corev1.Pod, error) {
+	if target != "" {
+		pod, err := resolveTargetPod(ctx, clientset, o.tPodNs, target)
+		if err == nil || !apierrors.IsNotFound(err) || strings.Contains(target, "/") {
+			return pod, err
+		}
+
+		// Find running pods of the name's prefix
+		pods, listErr := getRunningPods(ctx, clientset, o.tPodNs)
+		if listErr != nil {
+			return nil, err
+		}
+		var prefixed []string
+		for _, name := range getPodNames(pods) {
+			if strings.HasPrefix(name, target) {
+				prefixed = append(prefixed, name)
+			}
+		}
+		if len(prefixed) == 1 {
+			fmt.Fprintf(os.Stderr, "Selected pod %s of prefix %s.\n", prefixed[0], target)
+			return getPodByName(pods, prefixed[0]), nil
+		}
+
+		// Select one of running pods matching the name
+		candidates := filterFuzzy(getPodNames(pods), target)
+		switch {
+		case len(candidates) == 0:
+			return nil, err
+		case !interactive:
+			return nil, fmt.Errorf("pod %s doesn't exist. candidates : %s", target, strings.Join(candidates, ", "))
+		}
+		podName, err := pickItem("Pod", candidates)
+		if err != nil {
+			return nil, err
+		}
+		return getPodByName(pods, podName), nil
+	}
+
+	// Select one of running pods
+	pods, err := getRunningPods(ctx, clientset, o.tPodNs)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no running pod in namespace %s", o.tPodNs)
+	}
+	if !interactive {
+		return nil, fmt.Errorf("no target pod. candidates : %s", strings.Join(getPodNames(pods), ", "))
+	}
+
+	// Select pod and container together if container isn't set
+	if o.tContName != "" {
+		podName, err := pickItem("Pod", getPodNames(pods))
+		if err != nil {
+			return nil, err
+		}
+		return getPodByName(pods, podName), nil
+	}
+	var items []string
+	for i := range pods {
+		for _, contName := range getContainerNames(&pods[i]) {
+			if _, _, err := getContainerRuntimeID(&pods[i], contName); err == nil {
+				items = append(items, pods[i].Name+"/"+contName)
+			}
+		}
+	}
+	item, err := pickItem("Pod/Container", items)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(item, "/", 2)
+	o.tContName = parts[1]
+	return getPodByName(pods, parts[0]), nil
+}
+
+// resolveContainerName gets container name from name, index or unique prefix. If name is empty, it gets
+// default container from annotation or the first container. If prefix is ambiguous, it returns candidates with error
+func resolveContainerName(pod *corev1.Pod, name string) (string, []string, error) {
+	names := getContainerNames(pod)
+	if name == "" {
+		if defaultName, ok := pod.Annotations[defaultContainerAnnotation]; ok {
+			for _, n := range names {
+				if n == defaultName {
+					return n, nil, nil
+				}
+			}
+		}
+		return pod.Spec.Containers[0].Name, nil, nil
+	}
+
+	// Check exact name first, then index and prefix
+	for _, n := range names {
+		if n == name {
+			return n, nil, nil
+		}
+	}
+	if index, err := strconv.Atoi(name); err == nil {
+		if index < 0 || index >= len(pod.Spec.Containers) {
+			return "", nil, fmt.Errorf("container index %d is out of range", index)
+		}
+		return pod.Spec.Containers[index].Name, nil, nil
+	}
+	var candidates []string
+	for _, n := range names {
+		if strings.HasPrefix(n, name) {
+			candidates = append(candidates, n)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", nil, fmt.Errorf("container %s doesn't exist in pod %s", name, pod.Name)
+	case 1:
+		return candidates[0], nil, nil
+	}
+	return "", candidates, fmt.Errorf("container %s is ambiguous. candidates : %s", name, strings.Join(candidates, ", "))
+}
+
+// resolveTargetPods gets all running pods from target or label selector
+func resolveTargetPods(ctx context.Context, clientset kubernetes.Interface, namespace, target, labelSelector string) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	if labelSelector != "" {
+		// Get pods through label selector
+		selector, err := metav1.ParseToLabelSelector(labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		pods, err = getPodsBySelector(ctx, clientset, namespace, selector)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		targetType, targetName, err := parseTarget(target)
+		if err != nil {
+			return nil, err
+		}
+
+		if targetType == targetTypePod {
+			// Get the pod
+			pod, err := resolveTargetPod(ctx, clientset, namespace, target)
+			if err != nil {
+				return nil, err
+			}
+			pods = []corev1.Pod{*pod}
+		} else {
+			// Get pods through the target's selector
+			selector, err := getTargetSelector(ctx, clientset, namespace, targetType, targetName)
+			if err != nil {
+				return nil, err
+			}
+			pods, err = getPodsBySelector(ctx, clientset, namespace, selector)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Skip not running pods
+	var result []corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning {
+			fmt.Fprintf(os.Stderr, "Skip not running pod %s.\n", pod.Name)
+			continue
+		}
+		result = append(result, pod)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no running pod")
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// getTargetSelector gets pod selector of workload or service
+func getTargetSelector(ctx context.Context, clientset kubernetes.Interface, namespace, targetType, targetName string) (*metav1.LabelSelector, error) {
+	switch targetType {
+	case targetTypeDeployment:
+		deploy, err := clientset.AppsV1().Deployments(namespace).Get(ctx, targetName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return deploy.Spec.Selector, nil
+
+	case targetTypeStatefulSet:
+		sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, targetName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return sts.Spec.Selector, nil
+
+	case targetTypeDaemonSet:
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, targetName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return ds.Spec.Selector, nil
+
+	case targetTypeReplicaSet:
+		rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, targetName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return rs.Spec.Selector, nil
+
+	case targetTypeJob:
+		job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, targetName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return job.Spec.Selector, nil
+
+	case targetTypeService:
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, targetName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if len(svc.Spec.Selector) == 0 {
+			return nil, fmt.Errorf("service %s doesn't have selector", targetName)
+		}
+		return &metav1.LabelSelector{MatchLabels: svc.Spec.Selector}, nil
+	}
+	return nil, fmt.Errorf("%s doesn't have selector", targetType)
+}
+
+func getPodFromEndpoints(ctx context.Context, clientset kubernetes.Interface, namespace, svcName string) (*corev1.Pod, error) {
+	// Fall back to service's selector if endpoints can't be got
+	endpoints, err := clientset.CoreV1().Endpoints(namespace).Get(ctx, svcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil
+	}
+
+	// Get the first ready pod address
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			if address.TargetRef == nil || address.TargetRef.Kind != "Pod" {
+				continue
+			}
+			pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, address.TargetRef.Name, metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Selected pod %s of service/%s.\n", pod.Name, svcName)
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
+
+func getRunningPods(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]corev1.Pod, error) {
+	pods, err := getPodsBySelector(ctx, clientset, namespace, &metav1.LabelSelector{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning {
+			result = append(result, pod)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func getPodsBySelector(ctx context.Context, clientset kubernetes.Interface, namespace string, selector *metav1.LabelSelector) ([]corev1.Pod, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var pods *corev1.PodList
+	err = retryOnTransientError(ctx, func() error {
+		var listErr error
+		pods, listErr = clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+		return listErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip terminating pods
+	var result []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			result = append(result, pod)
+		}
+	}
+	return result, nil
+}
+
+// sortPodsByReady sorts ready pods first, then running pods, then older pods first
+func sortPodsByReady(pods []corev1.Pod) {
+	sort.SliceStable(pods, func(i, j int) bool {
+		if isPodReady(&pods[i]) != isPodReady(&pods[j]) {
+			return isPodReady(&pods[i])
+		}
+		if (pods[i].Status.Phase == corev1.PodRunning) != (pods[j].Status.Phase == corev1.PodRunning) {
+			return pods[i].Status.Phase == corev1.PodRunning
+		}
+		if !pods[i].CreationTimestamp.Equal(&pods[j].CreationTimestamp) {
+			return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+}
+
+func getPodByName(pods []corev1.Pod, name string) *corev1.Pod {
+	for i := range pods {
+		if pods[i].Name == name {
+			return &pods[i]
+		}
+	}
+	return nil
+}
+
+// getContainerNames gets names of containers, init containers and ephemeral containers
+func getContainerNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, cont := range pod.Spec.Containers {
+		names = append(names, cont.Name)
+	}
+	for _, cont := range pod.Spec.InitContainers {
+		names = append(names, cont.Name)
+	}
+	for _, cont := range pod.Spec.EphemeralContainers {
+		names = append(names, cont.Name)
+	}
+	return names
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
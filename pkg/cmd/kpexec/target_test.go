@@ -0,0 +1,226 @@
+package kpexec
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args          []string
+		argsLenAtDash int
+		target        string
+		cmd           []string
+		err           bool
+	}{
+		{[]string{"mypod", "date"}, 1, "mypod", []string{"date"}, false},
+		{[]string{"mypod", "ls", "/"}, -1, "mypod", []string{"ls", "/"}, false},
+		{[]string{"date"}, 0, "", []string{"date"}, false},
+		{[]string{"mypod"}, -1, "", nil, true},
+		{[]string{"mypod", "other", "date"}, 2, "", nil, true},
+	}
+
+	for _, test := range tests {
+		target, cmd, err := parseArgs(test.args, test.argsLenAtDash, true)
+		if target != test.target || !reflect.DeepEqual(cmd, test.cmd) || (err != nil) != test.err {
+			t.Fatalf("%v : target %s, cmd %v, err %v is not expected", test.args, target, cmd, err)
+		}
+	}
+}
+
+func TestParseArgsWithoutTarget(t *testing.T) {
+	target, cmd, err := parseArgs([]string{"date"}, 0, false)
+	if target != "" || !reflect.DeepEqual(cmd, []string{"date"}) || err != nil {
+		t.Fatalf("target %s, cmd %v, err %v is not expected", target, cmd, err)
+	}
+	if _, _, err := parseArgs([]string{"mypod", "date"}, 1, false); err == nil {
+		t.Fatalf("target with selector is allowed")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target     string
+		targetType string
+		name       string
+		err        bool
+	}{
+		{"mypod", targetTypePod, "mypod", false},
+		{"po/mypod", targetTypePod, "mypod", false},
+		{"deploy/api", targetTypeDeployment, "api", false},
+		{"STS/db", targetTypeStatefulSet, "db", false},
+		{"svc/web", targetTypeService, "web", false},
+		{"node/node1", targetTypeNode, "node1", false},
+		{"cm/config", "", "", true},
+		{"deploy/", "", "", true},
+	}
+
+	for _, test := range tests {
+		targetType, name, err := parseTarget(test.target)
+		if targetType != test.targetType || name != test.name || (err != nil) != test.err {
+			t.Fatalf("%s : type %s, name %s, err %v is not expected", test.target, targetType, name, err)
+		}
+	}
+}
+
+func TestResolveTargetPod(t *testing.T) {
+	labels := map[string]string{"app": "api"}
+	readyCond := []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Selector: labels},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-a", Namespace: "default", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-b", Namespace: "default", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, Conditions: readyCond},
+		},
+	)
+
+	for _, target := range []string{"api-b", "deploy/api", "svc/api"} {
+		pod, err := resolveTargetPod(context.Background(), clientset, "default", target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Name != "api-b" {
+			t.Fatalf("%s : pod %s is not expected", target, pod.Name)
+		}
+	}
+
+	if _, err := resolveTargetPod(context.Background(), clientset, "default", "sts/api"); err == nil {
+		t.Fatalf("not existing target is resolved")
+	}
+}
+
+func TestResolveTargetPods(t *testing.T) {
+	labels := map[string]string{"app": "api"}
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-b", Namespace: "default", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-a", Namespace: "default", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-c", Namespace: "default", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+	)
+
+	for _, test := range []struct{ target, selector string }{{"deploy/api", ""}, {"", "app=api"}} {
+		pods, err := resolveTargetPods(context.Background(), clientset, "default", test.target, test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pods) != 2 || pods[0].Name != "api-a" || pods[1].Name != "api-b" {
+			t.Fatalf("%v : pods %v are not expected", test, pods)
+		}
+	}
+}
+
+func TestSelectTargetPod(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-a", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-b", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-a", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "wordpress-eb7f", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	)
+	o := &Options{tPodNs: "default"}
+
+	// Exact and unique prefix pod names
+	for target, expected := range map[string]string{"api-a": "api-a", "web": "web-a", "wordpress": "wordpress-eb7f"} {
+		pod, err := o.selectTargetPod(context.Background(), clientset, target, false)
+		if err != nil || pod.Name != expected {
+			t.Fatalf("%s : pod %v, err %v is not expected", target, pod, err)
+		}
+	}
+
+	// Ambiguous, omitted and not found pod names
+	for _, target := range []string{"api", "", "db"} {
+		if _, err := o.selectTargetPod(context.Background(), clientset, target, false); err == nil {
+			t.Fatalf("%s : pod is selected without picker", target)
+		}
+	}
+
+	// Fuzzy matched pod isn't selected without picker even if it's unique
+	pod, err := o.selectTargetPod(context.Background(), clientset, "wpress", false)
+	if err == nil || !strings.Contains(err.Error(), "wordpress-eb7f") {
+		t.Fatalf("pod %v, err %v is not expected", pod, err)
+	}
+}
+
+func TestResolveContainerName(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "mypod",
+			Annotations: map[string]string{defaultContainerAnnotation: "app"},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers:     []corev1.Container{{Name: "istio-proxy"}, {Name: "app"}, {Name: "app-sidecar"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		expected   string
+		candidates []string
+		err        bool
+	}{
+		{"", "app", nil, false},
+		{"app", "app", nil, false},
+		{"1", "app", nil, false},
+		{"5", "", nil, true},
+		{"ist", "istio-proxy", nil, false},
+		{"in", "init", nil, false},
+		{"app-", "app-sidecar", nil, false},
+		{"i", "", []string{"istio-proxy", "init"}, true},
+		{"db", "", nil, true},
+	}
+
+	for _, test := range tests {
+		name, candidates, err := resolveContainerName(pod, test.name)
+		if name != test.expected || !reflect.DeepEqual(candidates, test.candidates) || (err != nil) != test.err {
+			t.Fatalf("%s : name %s, candidates %v, err %v is not expected", test.name, name, candidates, err)
+		}
+	}
+
+	// Fall back to the first container if annotation's container doesn't exist
+	pod.Annotations[defaultContainerAnnotation] = "none"
+	if name, _, _ := resolveContainerName(pod, ""); name != "istio-proxy" {
+		t.Fatalf("name %s is not expected", name)
+	}
+}
@@ -0,0 +1,302 @@
+package kpexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+const (
+	eventReasonFailedMount   = "FailedMount"
+	eventMessageHostPathType = "hostPath type check failed"
+)
+
+var (
+	// Container waiting reasons which are not recovered without user's action
+	fatalWaitingReasons = map[string]bool{
+		"ErrImagePull":               true,
+		"ImagePullBackOff":           true,
+		"InvalidImageName":           true,
+		"ErrImageNeverPull":          true,
+		"CreateContainerConfigError": true,
+		"CreateContainerError":       true,
+		"RunContainerError":          true,
+	}
+
+	// Target container's waiting reasons which are not recovered by kubelet's retry. Image pull errors and
+	// crash loop are retried while a rollout is in progress, so they aren't included
+	unrecoverableWaitingReasons = map[string]bool{
+		"InvalidImageName":           true,
+		"ErrImageNeverPull":          true,
+		"CreateContainerConfigError": true,
+	}
+
+	// Pod event reasons which are not recovered without user's action. Sandbox creation failures aren't included
+	// because kubelet retries them like CNI isn't ready on a new node. They're printed at timeout
+	fatalEventReasons = map[string]bool{
+		"InspectFailed":     true,
+		"ErrImageNeverPull": true,
+	}
+
+	// Pod event reasons to show image pull progress
+	imagePullEventReasons = map[string]bool{
+		"Pulling": true,
+		"Pulled":  true,
+	}
+)
+
+func (o *Options) waitCnsPodRunning(ctx context.Context, clientset kubernetes.Interface, cnsPodName string) (*corev1.Pod, error) {
+	// Watch cnsenter pod's events
+	// Events are only used to fail fast and show progress, so ignore watch error
+	var eventCh <-chan watch.Event
+	eventWatch, err := clientset.CoreV1().Events(o.cnsPodNamespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.namespace=%s,involvedObject.name=%s", o.cnsPodNamespace, cnsPodName),
+	})
+	if err == nil {
+		defer eventWatch.Stop()
+		eventCh = eventWatch.ResultChan()
+	}
+
+	for {
+		// Get cnsenter pod's latest status and resource version
+		// If watch is expired, get them again and restart watch
+		var pod *corev1.Pod
+		err := retryOnTransientError(ctx, func() error {
+			var getErr error
+			pod, getErr = clientset.CoreV1().Pods(o.cnsPodNamespace).Get(ctx, cnsPodName, metav1.GetOptions{})
+			return getErr
+		})
+		if err != nil {
+			return nil, err
+		}
+		if done, err := checkCnsPodStatus(pod); done || err != nil {
+			return pod, err
+		}
+
+		// Watch cnsenter pod from the resource version
+		// Retry watcher reconnects when watch is closed by API server restart or timeout
+		podWatch, err := watchtools.NewRetryWatcher(pod.ResourceVersion, &cache.ListWatch{
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = "metadata.name=" + cnsPodName
+				return clientset.CoreV1().Pods(o.cnsPodNamespace).Watch(ctx, options)
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		pod, err = o.waitCnsPodWatch(ctx, podWatch, eventCh)
+		podWatch.Stop()
+		if pod != nil || err != nil {
+			return pod, err
+		}
+	}
+}
+
+// waitCnsPodWatch returns nil pod and nil error if watch needs to be restarted
+func (o *Options) waitCnsPodWatch(ctx context.Context, podWatch watch.Interface, eventCh <-chan watch.Event) (*corev1.Pod, error) {
+	for {
+		select {
+		case podEvent, ok := <-podWatch.ResultChan():
+			if !ok {
+				return nil, nil
+			}
+
+			switch podEvent.Type {
+			case watch.Added, watch.Modified:
+				pod, ok := podEvent.Object.(*corev1.Pod)
+				if !ok {
+					continue
+				}
+				if done, err := checkCnsPodStatus(pod); done || err != nil {
+					return pod, err
+				}
+			case watch.Deleted:
+				return nil, fmt.Errorf("cnsenter pod is deleted")
+			case watch.Error:
+				// Restart watch if resource version is expired
+				err := apierrors.FromObject(podEvent.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return nil, nil
+				}
+				return nil, err
+			}
+
+		case event, ok := <-eventCh:
+			if !ok {
+				eventCh = nil
+				continue
+			}
+			podEvent, ok := event.Object.(*corev1.Event)
+			if !ok {
+				continue
+			}
+			if isFatalEvent(podEvent) {
+				return nil, fmt.Errorf("%s : %s", podEvent.Reason, podEvent.Message)
+			} else if imagePullEventReasons[podEvent.Reason] {
+				fmt.Fprintf(os.Stderr, "%s\n", podEvent.Message)
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isFatalEvent returns true if the pod event isn't recovered without user's action. Mount failures are
+// usually retried like projected volumes, but hostPath's type mismatch isn't recovered
+func isFatalEvent(event *corev1.Event) bool {
+	if event.Reason == eventReasonFailedMount {
+		return strings.Contains(event.Message, eventMessageHostPathType)
+	}
+	return fatalEventReasons[event.Reason]
+}
+
+// checkCnsPodStatus returns true if cnsenter pod is running or terminated,
+// and returns error if cnsenter pod can't run
+func checkCnsPodStatus(pod *corev1.Pod) (bool, error) {
+	// Check container's waiting reason
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && fatalWaitingReasons[status.State.Waiting.Reason] {
+			return false, fmt.Errorf("%s : %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+		}
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodRunning, corev1.PodSucceeded:
+		return true, nil
+	case corev1.PodFailed:
+		// Check container was run. If not, pod is rejected by kubelet
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil && status.ContainerID != "" {
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("%s : %s", pod.Status.Reason, pod.Status.Message)
+	}
+	return false, nil
+}
+
+// waitTargetContainerRunning watches target pod until target container is running and returns the latest pod.
+// If timeout is zero, it doesn't wait
+func waitTargetContainerRunning(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, contName string,
+	timeout time.Duration) (*corev1.Pod, error) {
+	if done, err := checkTargetContainerStatus(pod, contName); done || err != nil || timeout <= 0 {
+		return pod, err
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for container %s of pod %s to be running...\n", contName, pod.Name)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Watch target pod from list. Watch is restarted with list when it's expired
+	fieldSelector := "metadata.name=" + pod.Name
+	podLW := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return clientset.CoreV1().Pods(pod.Namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return clientset.CoreV1().Pods(pod.Namespace).Watch(ctx, options)
+		},
+	}
+	// Keep the last waiting reason to show why the container isn't running at timeout
+	lastReason := getContainerWaitingReason(pod, contName)
+	event, err := watchtools.UntilWithSync(ctx, podLW, &corev1.Pod{}, nil, func(event watch.Event) (bool, error) {
+		switch event.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("pod %s is deleted", pod.Name)
+		case watch.Added, watch.Modified:
+			if pod, ok := event.Object.(*corev1.Pod); ok {
+				if reason := getContainerWaitingReason(pod, contName); reason != "" {
+					lastReason = reason
+				}
+				return checkTargetContainerStatus(pod, contName)
+			}
+		}
+		return false, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		if lastReason != "" {
+			return nil, fmt.Errorf("container %s of pod %s isn't running in %s : waiting %s", contName, pod.Name, timeout, lastReason)
+		}
+		return nil, fmt.Errorf("container %s of pod %s isn't running in %s", contName, pod.Name, timeout)
+	} else if err != nil {
+		return nil, err
+	}
+	return event.Object.(*corev1.Pod), nil
+}
+
+// checkTargetContainerStatus returns true if target container is running,
+// and returns error if target container can't run or is terminated without restart
+func checkTargetContainerStatus(pod *corev1.Pod, contName string) (bool, error) {
+	if pod.DeletionTimestamp != nil {
+		return false, fmt.Errorf("pod %s is terminating", pod.Name)
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false, fmt.Errorf("pod %s is completed with phase %s", pod.Name, pod.Status.Phase)
+	}
+
+	// Container status doesn't exist until pod is scheduled
+	status, err := getContainerStatus(pod, contName)
+	if err != nil {
+		return false, nil
+	}
+	if status.State.Waiting != nil && unrecoverableWaitingReasons[status.State.Waiting.Reason] {
+		return false, fmt.Errorf("container %s is waiting : %s %s", contName,
+			status.State.Waiting.Reason, status.State.Waiting.Message)
+	} else if status.State.Terminated != nil && !isContainerRestarted(pod, contName, status.State.Terminated.ExitCode) {
+		return false, fmt.Errorf("container %s is terminated with exit code %d : %s %s", contName,
+			status.State.Terminated.ExitCode, status.State.Terminated.Reason, status.State.Terminated.Message)
+	}
+	return status.State.Running != nil && status.ContainerID != "", nil
+}
+
+// isContainerRestarted returns true if kubelet restarts the container terminated with the exit code.
+// Ephemeral containers and completed init containers except sidecars aren't restarted
+func isContainerRestarted(pod *corev1.Pod, contName string, exitCode int32) bool {
+	for _, cont := range pod.Spec.EphemeralContainers {
+		if cont.Name == contName {
+			return false
+		}
+	}
+	for _, cont := range pod.Spec.InitContainers {
+		if cont.Name == contName {
+			if cont.RestartPolicy != nil && *cont.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+				return true
+			}
+			return exitCode != 0 && pod.Spec.RestartPolicy != corev1.RestartPolicyNever
+		}
+	}
+
+	switch pod.Spec.RestartPolicy {
+	case corev1.RestartPolicyNever:
+		return false
+	case corev1.RestartPolicyOnFailure:
+		return exitCode != 0
+	}
+	return true
+}
+
+// getContainerWaitingReason gets the reason of waiting container. If container isn't waiting, it returns empty
+func getContainerWaitingReason(pod *corev1.Pod, contName string) string {
+	status, err := getContainerStatus(pod, contName)
+	if err != nil || status.State.Waiting == nil {
+		return ""
+	}
+	return status.State.Waiting.Reason
+}
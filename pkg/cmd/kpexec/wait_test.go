@@ -0,0 +1,212 @@
+package kpexec
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckCnsPodStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status corev1.PodStatus
+		done   bool
+		err    bool
+	}{
+		{"pending", corev1.PodStatus{Phase: corev1.PodPending}, false, false},
+		{"running", corev1.PodStatus{Phase: corev1.PodRunning}, true, false},
+		{"image pull error", corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}}},
+			},
+		}, false, true},
+		{"container creating", corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			},
+		}, false, false},
+		{"rejected", corev1.PodStatus{Phase: corev1.PodFailed, Reason: "OutOfcpu"}, false, true},
+		{"failed", corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{ContainerID: "containerd://abc", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}},
+			},
+		}, true, false},
+	}
+
+	for _, test := range tests {
+		done, err := checkCnsPodStatus(&corev1.Pod{Status: test.status})
+		if done != test.done || (err != nil) != test.err {
+			t.Fatalf("%s : done %v, err %v is not expected", test.name, done, err)
+		}
+	}
+}
+
+func TestCheckTargetContainerStatus(t *testing.T) {
+	sidecarPolicy := corev1.ContainerRestartPolicyAlways
+	tests := []struct {
+		name   string
+		spec   corev1.PodSpec
+		status corev1.PodStatus
+		done   bool
+		err    bool
+	}{
+		{"not scheduled", corev1.PodSpec{}, corev1.PodStatus{Phase: corev1.PodPending}, false, false},
+		{"container creating", corev1.PodSpec{}, corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			},
+		}, false, false},
+		{"image pull back off", corev1.PodSpec{}, corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+			},
+		}, false, false},
+		{"invalid image name", corev1.PodSpec{}, corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "InvalidImageName"}}},
+			},
+		}, false, true},
+		{"running", corev1.PodSpec{}, corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://abc", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		}, true, false},
+		{"crash loop", corev1.PodSpec{}, corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+		}, false, false},
+		{"terminated to restart", corev1.PodSpec{RestartPolicy: corev1.RestartPolicyAlways}, corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}},
+			},
+		}, false, false},
+		{"terminated without restart", corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever}, corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}},
+			},
+		}, false, true},
+		{"completed init container", corev1.PodSpec{InitContainers: []corev1.Container{{Name: "app"}}}, corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://abc", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+			},
+		}, false, true},
+		{"completed sidecar", corev1.PodSpec{InitContainers: []corev1.Container{{Name: "app", RestartPolicy: &sidecarPolicy}}}, corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://abc", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+			},
+		}, false, false},
+		{"succeeded", corev1.PodSpec{}, corev1.PodStatus{Phase: corev1.PodSucceeded}, false, true},
+	}
+
+	for _, test := range tests {
+		done, err := checkTargetContainerStatus(&corev1.Pod{Spec: test.spec, Status: test.status}, "app")
+		if done != test.done || (err != nil) != test.err {
+			t.Fatalf("%s : done %v, err %v is not expected", test.name, done, err)
+		}
+	}
+}
+
+func TestIsFatalEvent(t *testing.T) {
+	tests := []struct {
+		reason  string
+		message string
+		fatal   bool
+	}{
+		{"FailedCreatePodSandBox", "failed to setup network", false},
+		{"InspectFailed", "failed to apply default image tag", true},
+		{"FailedMount", `MountVolume.SetUp failed for volume "kube-api-access" : object "debug"/"kube-root-ca.crt" not registered`, false},
+		{"FailedMount", `MountVolume.SetUp failed for volume "container-containerd-root" : hostPath type check failed: /run/containerd is not a directory`, true},
+		{"Scheduled", "Successfully assigned debug/cnsenter to node1", false},
+	}
+
+	for _, test := range tests {
+		if fatal := isFatalEvent(&corev1.Event{Reason: test.reason, Message: test.message}); fatal != test.fatal {
+			t.Fatalf("event %s (%s) fatal %t is not expected", test.reason, test.message, fatal)
+		}
+	}
+}
+
+func TestWaitTargetContainerRunningTimeout(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "mypod", Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+
+	// Without timeout, pod is returned as it is
+	if result, err := waitTargetContainerRunning(context.Background(), clientset, pod, "app", 0); result != pod || err != nil {
+		t.Fatalf("pod %v, err %v is not expected", result, err)
+	}
+
+	// Pending pod isn't running until timeout
+	if _, err := waitTargetContainerRunning(context.Background(), clientset, pod, "app", 100*time.Millisecond); err == nil {
+		t.Fatalf("pending pod is running")
+	}
+
+	// Timeout error has the last waiting reason
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+	}
+	clientset = fake.NewSimpleClientset(pod)
+	_, err := waitTargetContainerRunning(context.Background(), clientset, pod, "app", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "ContainerCreating") {
+		t.Fatalf("error %v is not expected", err)
+	}
+
+	// Image pull and crash loop are retried until the container is running
+	for _, reason := range []string{"ImagePullBackOff", "CrashLoopBackOff"} {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}},
+		}
+		clientset := fake.NewSimpleClientset(pod)
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			runningPod := pod.DeepCopy()
+			runningPod.Status.Phase = corev1.PodRunning
+			runningPod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://abc", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			}
+			clientset.CoreV1().Pods("default").UpdateStatus(context.Background(), runningPod, metav1.UpdateOptions{})
+		}()
+		result, err := waitTargetContainerRunning(context.Background(), clientset, pod, "app", 10*time.Second)
+		if err != nil || result.Status.Phase != corev1.PodRunning {
+			t.Fatalf("%s : pod %v, err %v is not expected", reason, result, err)
+		}
+	}
+
+	// Unrecoverable states fail without waiting timeout
+	for _, test := range []struct {
+		restartPolicy corev1.RestartPolicy
+		state         corev1.ContainerState
+	}{
+		{corev1.RestartPolicyAlways, corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "InvalidImageName"}}},
+		{corev1.RestartPolicyNever, corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}},
+	} {
+		pod.Spec.RestartPolicy = test.restartPolicy
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", State: test.state}}
+		clientset = fake.NewSimpleClientset(pod)
+		start := time.Now()
+		_, err := waitTargetContainerRunning(context.Background(), clientset, pod, "app", time.Minute)
+		if err == nil || time.Since(start) > 10*time.Second {
+			t.Fatalf("state %+v : error %v is not expected", test.state, err)
+		}
+	}
+}
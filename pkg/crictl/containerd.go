@@ -0,0 +1,222 @@
+package crictl
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/containerd/containerd"
+	taskservice "github.com/containerd/containerd/api/services/tasks/v1"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+)
+
+const (
+	runtimeContainerd = "containerd"
+
+	contdNsK8s      = "k8s.io"
+	contdSocketPath = "/run/containerd/containerd.sock"
+	contdTaskPlugin = "io.containerd.runtime.v2.task"
+)
+
+func init() {
+	Register(runtimeContainerd, newContainerd)
+}
+
+// containerdRuntime gets info through containerd's CRI and snapshotter. Containers out of CRI's namespace
+// are got through containerd's API
+type containerdRuntime struct {
+	criRuntime
+	contdSettings
+	defaultStatePath string
+}
+
+func newContainerd() (Runtime, error) {
+	// Detect containerd's location of the distribution like k3s, RKE2 and MicroK8s
+	location := detectContainerdLocation()
+	return &containerdRuntime{
+		criRuntime:       criRuntime{socketPath: location.socketPath},
+		defaultStatePath: location.statePath,
+	}, nil
+}
+
+func (c *containerdRuntime) SetSocketPath(socketPath string) error {
+	location := getContainerdLocation(socketPath)
+	c.socketPath = location.socketPath
+	c.defaultStatePath = location.statePath
+	return nil
+}
+
+func (c *containerdRuntime) GetContainerInfo(contID string) (*ContainerInfo, error) {
+	// CRI's containers are in k8s.io namespace
+	namespace := contdNsK8s
+	var contInfo *ContainerInfo
+	var err error
+	if c.namespace == "" || c.namespace == contdNsK8s {
+		contInfo, err = c.criRuntime.GetContainerInfo(contID)
+	}
+
+	// Search the container in the namespace or all containerd's namespaces if it isn't CRI's container
+	if c.namespace != "" && c.namespace != contdNsK8s {
+		contInfo, namespace, err = c.getContdContainerInfo(contID)
+	} else if c.namespace == "" && errors.Is(err, ErrNotFound) {
+		if contdInfo, contdNamespace, contdErr := c.getContdContainerInfo(contID); contdErr == nil {
+			contInfo, namespace, err = contdInfo, contdNamespace, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.resolveRootPath(contInfo, c.socketPath, c.defaultStatePath, namespace, contID)
+	return contInfo, nil
+}
+
+func (c *containerdRuntime) GetSnapshotMounts(contID string) ([]Mount, error) {
+	// Get mounts from snapshotter. Container's snapshot is kept until the container is removed
+	client, err := containerd.New(getDialPath(c.socketPath))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	// Search the container in CRI's namespace first
+	nsList := []string{c.namespace}
+	if c.namespace == "" {
+		nsList, err = listContdNamespaces(client, contID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, namespace := range nsList {
+		ctx := namespaces.WithNamespace(context.Background(), namespace)
+		cont, err := client.LoadContainer(ctx, contID)
+		if errdefs.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, newError("load container", contID, err)
+		}
+		info, err := cont.Info(ctx)
+		if err != nil {
+			return nil, newError("get info of container", contID, err)
+		}
+		contdMounts, err := client.SnapshotService(info.Snapshotter).Mounts(ctx, info.SnapshotKey)
+		if err != nil {
+			return nil, newError("get snapshot mounts of container", contID, err)
+		}
+
+		var mounts []Mount
+		for _, m := range contdMounts {
+			mounts = append(mounts, Mount{Type: m.Type, Source: m.Source, Options: m.Options})
+		}
+		return mounts, nil
+	}
+	return nil, &Error{Op: "load container", ID: contID, Err: ErrNotFound}
+}
+
+// getContdContainerInfo gets container's info through containerd's API
+func (c *containerdRuntime) getContdContainerInfo(contID string) (*ContainerInfo, string, error) {
+	client, err := containerd.New(getDialPath(c.socketPath))
+	if err != nil {
+		return nil, "", err
+	}
+	defer client.Close()
+	return getContdContainerInfo(client, c.namespace, contID)
+}
+
+// contdSettings are containerd's namespace and state dir set by flags. Empty settings are detected
+type contdSettings struct {
+	namespace string
+	statePath string
+}
+
+func (s *contdSettings) SetContainerdNamespace(namespace string) {
+	s.namespace = namespace
+}
+
+func (s *contdSettings) SetContainerdStatePath(statePath string) {
+	s.statePath = statePath
+}
+
+// resolveRootPath resolves container's rootfs path relative to the task's bundle
+func (s *contdSettings) resolveRootPath(contInfo *ContainerInfo, socketPath, defaultStatePath, namespace, contID string) {
+	if contInfo.RootPath == "" || filepath.IsAbs(contInfo.RootPath) {
+		return
+	}
+	contInfo.RootPath = filepath.Join(s.getBundlePath(socketPath, defaultStatePath, namespace, contID, contInfo.PID), contInfo.RootPath)
+}
+
+// getBundlePath gets the bundle path of container's task. The running task's bundle is got from the task's shim,
+// otherwise it's in containerd's state dir set by flag or detected from containerd serving the socket
+func (s *contdSettings) getBundlePath(socketPath, defaultStatePath, namespace, contID string, pid uint64) string {
+	if s.statePath == "" && pid != 0 {
+		// Shim serves the tasks of a pod and runs in the first task's bundle, so bundles of the namespace are siblings
+		if shimBundlePath := getShimBundlePath(pid); filepath.Base(filepath.Dir(shimBundlePath)) == namespace {
+			return filepath.Join(filepath.Dir(shimBundlePath), contID)
+		}
+	}
+
+	statePath := s.statePath
+	if statePath == "" {
+		statePath = getContainerdStatePath(socketPath)
+	}
+	if statePath == "" {
+		statePath = defaultStatePath
+	}
+	return filepath.Join(statePath, contdTaskPlugin, namespace, contID)
+}
+
+// getContdContainerInfo gets container's info from containerd's container and task in the namespace. If the
+// namespace is empty, the container is searched in all namespaces. It returns the container's namespace
+func getContdContainerInfo(client *containerd.Client, namespace, contID string) (*ContainerInfo, string, error) {
+	nsList := []string{namespace}
+	if namespace == "" {
+		var err error
+		nsList, err = listContdNamespaces(client, contID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, namespace := range nsList {
+		ctx := namespaces.WithNamespace(context.Background(), namespace)
+		cont, err := client.LoadContainer(ctx, contID)
+		if errdefs.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, "", newError("load container", contID, err)
+		}
+		spec, err := cont.Spec(ctx)
+		if err != nil {
+			return nil, "", newError("get spec of container", contID, err)
+		}
+
+		// Stopped container doesn't have a task
+		var pid uint64
+		task, err := client.TaskService().Get(ctx, &taskservice.GetRequest{ContainerID: contID})
+		if err == nil {
+			pid = uint64(task.Process.Pid)
+		} else if err = errdefs.FromGRPC(err); !errdefs.IsNotFound(err) {
+			return nil, "", newError("get task of container", contID, err)
+		}
+		return newContainerInfo(pid, spec), namespace, nil
+	}
+	return nil, "", &Error{Op: "load container", ID: contID, Err: ErrNotFound}
+}
+
+// listContdNamespaces lists containerd's namespaces. CRI's namespace comes first because most containers are there
+func listContdNamespaces(client *containerd.Client, contID string) ([]string, error) {
+	nsList, err := client.NamespaceService().List(context.Background())
+	if err != nil {
+		return nil, newError("list namespaces for container", contID, err)
+	}
+	var result []string
+	for _, namespace := range nsList {
+		if namespace == contdNsK8s {
+			result = append([]string{namespace}, result...)
+		} else {
+			result = append(result, namespace)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,129 @@
+package crictl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	criTimeout = 10 * time.Second
+)
+
+// verboseInfo is "info" of verbose container and pod sandbox status returned by containerd and CRI-O
+type verboseInfo struct {
+	PID         uint64      `json:"pid"`
+	RuntimeSpec *specs.Spec `json:"runtimeSpec"`
+}
+
+// criRuntime gets info through CRI runtime service. Runtimes supporting CRI embed it
+type criRuntime struct {
+	socketPath string
+}
+
+func (c *criRuntime) SetSocketPath(socketPath string) error {
+	c.socketPath = socketPath
+	return nil
+}
+
+func (c *criRuntime) GetContainerInfo(contID string) (*ContainerInfo, error) {
+	// Get container info through CRI's verbose container status
+	var resp *runtimeapi.ContainerStatusResponse
+	err := c.callRuntime(func(ctx context.Context, client runtimeapi.RuntimeServiceClient) error {
+		var statusErr error
+		resp, statusErr = client.ContainerStatus(ctx, &runtimeapi.ContainerStatusRequest{
+			ContainerId: contID,
+			Verbose:     true,
+		})
+		return statusErr
+	})
+	if err != nil {
+		return nil, newError("get status of container", contID, err)
+	}
+	info, err := parseVerboseInfo(resp.Info)
+	if err != nil {
+		return nil, &Error{Op: "get status of container", ID: contID, Err: err}
+	}
+	if info.RuntimeSpec == nil {
+		return nil, &Error{Op: "get status of container", ID: contID, Err: ErrNoInfo}
+	}
+	return newContainerInfo(info.PID, info.RuntimeSpec), nil
+}
+
+func (c *criRuntime) GetSandboxID(podUID string) (string, error) {
+	// Get ready pod sandbox of the pod through CRI
+	var resp *runtimeapi.ListPodSandboxResponse
+	err := c.callRuntime(func(ctx context.Context, client runtimeapi.RuntimeServiceClient) error {
+		var listErr error
+		resp, listErr = client.ListPodSandbox(ctx, &runtimeapi.ListPodSandboxRequest{
+			Filter: &runtimeapi.PodSandboxFilter{
+				State:         &runtimeapi.PodSandboxStateValue{State: runtimeapi.PodSandboxState_SANDBOX_READY},
+				LabelSelector: map[string]string{labelPodUID: podUID},
+			},
+		})
+		return listErr
+	})
+	if err != nil {
+		return "", newError("list pod sandboxes of pod", podUID, err)
+	}
+	if len(resp.Items) == 0 {
+		return "", &Error{Op: "get ready pod sandbox of pod", ID: podUID, Err: ErrNotFound}
+	}
+	return resp.Items[0].Id, nil
+}
+
+func (c *criRuntime) GetSandboxInitPid(sandboxID string) (uint64, error) {
+	// Get pod sandbox's init PID through CRI's verbose pod sandbox status
+	var resp *runtimeapi.PodSandboxStatusResponse
+	err := c.callRuntime(func(ctx context.Context, client runtimeapi.RuntimeServiceClient) error {
+		var statusErr error
+		resp, statusErr = client.PodSandboxStatus(ctx, &runtimeapi.PodSandboxStatusRequest{
+			PodSandboxId: sandboxID,
+			Verbose:      true,
+		})
+		return statusErr
+	})
+	if err != nil {
+		return 0, newError("get status of pod sandbox", sandboxID, err)
+	}
+	info, err := parseVerboseInfo(resp.Info)
+	if err != nil {
+		return 0, &Error{Op: "get status of pod sandbox", ID: sandboxID, Err: err}
+	}
+	if info.PID == 0 {
+		return 0, &Error{Op: "get status of pod sandbox", ID: sandboxID, Err: ErrNoInfo}
+	}
+	return info.PID, nil
+}
+
+// callRuntime calls CRI runtime service through the socket with timeout
+func (c *criRuntime) callRuntime(call func(ctx context.Context, client runtimeapi.RuntimeServiceClient) error) error {
+	conn, err := grpc.Dial("unix://"+getDialPath(c.socketPath), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), criTimeout)
+	defer cancel()
+	return call(ctx, runtimeapi.NewRuntimeServiceClient(conn))
+}
+
+// parseVerboseInfo parses "info" of verbose status
+func parseVerboseInfo(info map[string]string) (*verboseInfo, error) {
+	data, ok := info["info"]
+	if !ok {
+		return nil, ErrNoInfo
+	}
+	result := &verboseInfo{}
+	if err := json.Unmarshal([]byte(data), result); err != nil {
+		return nil, fmt.Errorf("failed to parse verbose info : %+v", err)
+	}
+	return result, nil
+}
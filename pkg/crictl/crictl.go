@@ -1,199 +1,112 @@
 package crictl
 
 import (
-	"context"
 	"fmt"
-	"os/exec"
+	"sort"
 
-	"github.com/containerd/containerd"
-	taskservice "github.com/containerd/containerd/api/services/tasks/v1"
-	"github.com/containerd/containerd/namespaces"
-	"github.com/tidwall/gjson"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 const (
-	cliCrictl           = "crictl"
-	cliCrictlOptInspect = "inspect"
+	labelPodUID = "io.kubernetes.pod.uid"
 
-	runtimeContainerd = "containerd"
-	runtimeCrio       = "cri-o"
-	runtimeDocker     = "docker"
-
-	contdNsDocker   = "moby"
-	contdSocketPath = "/run/containerd/containerd.sock"
+	// cnsenter runs in host PID namespace, so host's files are accessed through PID 1's root
+	hostRoot = "/proc/1/root"
 )
 
-type Crictl struct {
-	// For crictl CLI
-	runtime string
-	opts    []string
+var (
+	// Registered runtimes by name
+	runtimes = map[string]NewFunc{}
+)
 
-	// For containerd client
-	// Docker CRI with "unix:///var/run/dockershim.sock" doesn't return PID, CWD and Env info.
-	// To avoid this issue, we use containerd client directly instead of crictl CLI.
-	dCtx    context.Context
-	dClient *containerd.Client
+// Runtime gets container's and pod sandbox's info from the container runtime
+type Runtime interface {
+	// SetSocketPath sets the runtime's socket path instead of the default path
+	SetSocketPath(socketPath string) error
+	// GetContainerInfo gets container's info at once
+	GetContainerInfo(contID string) (*ContainerInfo, error)
+	// GetSandboxID gets the ready pod sandbox's ID of the pod
+	GetSandboxID(podUID string) (string, error)
+	// GetSandboxInitPid gets the pod sandbox's init PID
+	GetSandboxInitPid(sandboxID string) (uint64, error)
+	// GetSnapshotMounts gets mounts of container's snapshot, which is kept after the container is stopped
+	GetSnapshotMounts(contID string) ([]Mount, error)
 }
 
-func New(rt string) (*Crictl, error) {
-	// Docker
-	// Init containerd client
-	if rt == runtimeDocker {
-		client, err := containerd.New(contdSocketPath)
-		if err != nil {
-			return nil, err
-		}
-		ctx := namespaces.WithNamespace(context.Background(), contdNsDocker)
-
-		return &Crictl{
-			runtime: runtimeDocker,
-			dCtx:    ctx,
-			dClient: client,
-		}, nil
-	}
-
-	// Else
-	// Only set runtime
-	return &Crictl{
-		runtime: rt,
-	}, nil
+// ContainerdRuntime is a runtime getting info from containerd. Its namespace and state dir are detected by default
+type ContainerdRuntime interface {
+	Runtime
+	// SetContainerdNamespace sets containerd's namespace of containers instead of the runtime's default.
+	// containerd runtime searches all namespaces by default, and docker runtime uses "moby" namespace
+	SetContainerdNamespace(namespace string)
+	// SetContainerdStatePath sets containerd's state dir (containerd --state) instead of detecting it
+	SetContainerdStatePath(statePath string)
 }
 
-func (c *Crictl) SetSocketPath(socketPath string) error {
-	// Docker
-	// Replace new client for new socket path
-	if c.runtime == runtimeDocker {
-		client, err := containerd.New(socketPath)
-		if err != nil {
-			return err
-		}
-		c.dClient = client
-	}
-
-	// Else
-	// Set runtime endpoint option
-	c.opts = append(c.opts, "--runtime-endpoint", "unix://"+socketPath)
-	return nil
+// NewFunc returns a new runtime
+type NewFunc func() (Runtime, error)
+
+// ContainerInfo is container's info got from the runtime at once. Paths are host's paths
+type ContainerInfo struct {
+	PID        uint64                 `json:"pid"`
+	RootPath   string                 `json:"rootPath"`
+	CWDPath    string                 `json:"cwdPath"`
+	Envs       []string               `json:"envs"`
+	User       specs.User             `json:"user"`
+	Mounts     []specs.Mount          `json:"mounts"`
+	Namespaces []specs.LinuxNamespace `json:"namespaces"`
 }
 
-func (c *Crictl) GetInitPid(contID string) (uint64, error) {
-	// Docker
-	// Get PID from containerd
-	if c.runtime == runtimeDocker {
-		taskClient := c.dClient.TaskService()
-		cont, err := taskClient.Get(c.dCtx, &taskservice.GetRequest{
-			ContainerID: contID,
-		})
-		if err != nil {
-			return 0, err
-		}
-		return uint64(cont.Process.Pid), nil
-	}
-
-	// Else
-	// Get container info through crictl
-	args := append(c.opts, cliCrictlOptInspect, contID)
-	cmd := exec.Command(cliCrictl, args...)
-	info, err := cmd.Output()
-	if err != nil {
-		return 0, err
-	}
-
-	// Parsing init PID
-	pid := gjson.Get(string(info), "info.pid")
-	return pid.Uint(), nil
+// Mount is a mount of container's snapshot. Paths are host's paths
+type Mount struct {
+	Type    string   `json:"type"`
+	Source  string   `json:"source"`
+	Options []string `json:"options"`
 }
 
-func (c *Crictl) GetRootPath(contID string) (string, error) {
-	// Docker
-	// Get rootfs from containerd
-	if c.runtime == runtimeDocker {
-		cont, err := c.dClient.LoadContainer(c.dCtx, contID)
-		if err != nil {
-			return "", err
-		}
-		spec, err := cont.Spec(c.dCtx)
-		if err != nil {
-			return "", err
-		}
-		return spec.Root.Path, nil
-	}
-
-	// Else
-	// Get container info through crictl
-	args := append(c.opts, cliCrictlOptInspect, contID)
-	cmd := exec.Command(cliCrictl, args...)
-	info, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-
-	// Parsing rootfs and get absolute container rootfs path according to container runtime
-	rootDirPath := gjson.Get(string(info), "info.runtimeSpec.root.path")
-	if c.runtime == runtimeContainerd {
-		return fmt.Sprintf("/run/containerd/io.containerd.runtime.v2.task/k8s.io/%s/%s", contID, rootDirPath.String()), nil
+// Register registers the runtime by name. It panics if the name is already registered
+func Register(name string, newFunc NewFunc) {
+	if _, ok := runtimes[name]; ok {
+		panic(fmt.Sprintf("runtime %s is already registered", name))
 	}
-	return rootDirPath.String(), nil // CRI-O
+	runtimes[name] = newFunc
 }
 
-func (c *Crictl) GetCWDPath(contID string) (string, error) {
-	// Docker
-	// Get CWD from containerd
-	if c.runtime == runtimeDocker {
-		cont, err := c.dClient.LoadContainer(c.dCtx, contID)
-		if err != nil {
-			return "", err
-		}
-		spec, err := cont.Spec(c.dCtx)
-		if err != nil {
-			return "", err
-		}
-		return spec.Process.Cwd, nil
+// New returns the runtime registered by name
+func New(name string) (Runtime, error) {
+	newFunc, ok := runtimes[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not supported container runtime", name)
 	}
+	return newFunc()
+}
 
-	// Else
-	// Get container info through crictl
-	args := append(c.opts, cliCrictlOptInspect, contID)
-	cmd := exec.Command(cliCrictl, args...)
-	info, err := cmd.Output()
-	if err != nil {
-		return "", err
+// Runtimes returns sorted names of registered runtimes
+func Runtimes() []string {
+	var names []string
+	for name := range runtimes {
+		names = append(names, name)
 	}
-
-	// Parsing working dir
-	cwd := gjson.Get(string(info), "info.runtimeSpec.process.cwd")
-	return cwd.String(), nil
+	sort.Strings(names)
+	return names
 }
 
-func (c *Crictl) GetEnvs(contID string) ([]string, error) {
-	// Docker
-	// Get envs from containerd
-	if c.runtime == runtimeDocker {
-		cont, err := c.dClient.LoadContainer(c.dCtx, contID)
-		if err != nil {
-			return nil, err
-		}
-		spec, err := cont.Spec(c.dCtx)
-		if err != nil {
-			return nil, err
-		}
-		return spec.Process.Env, nil
+// newContainerInfo gets container info from OCI runtime spec
+func newContainerInfo(pid uint64, spec *specs.Spec) *ContainerInfo {
+	contInfo := &ContainerInfo{
+		PID:    pid,
+		Mounts: spec.Mounts,
 	}
-
-	// Else
-	// Get container info through crictl
-	args := append(c.opts, cliCrictlOptInspect, contID)
-	cmd := exec.Command(cliCrictl, args...)
-	info, err := cmd.Output()
-	if err != nil {
-		return nil, err
+	if spec.Root != nil {
+		contInfo.RootPath = spec.Root.Path
 	}
-
-	// Parsing envs
-	var result []string
-	envs := gjson.Get(string(info), "info.runtimeSpec.process.env")
-	for _, env := range envs.Array() {
-		result = append(result, env.String())
+	if spec.Process != nil {
+		contInfo.CWDPath = spec.Process.Cwd
+		contInfo.Envs = spec.Process.Env
+		contInfo.User = spec.Process.User
+	}
+	if spec.Linux != nil {
+		contInfo.Namespaces = spec.Linux.Namespaces
 	}
-	return result, nil
+	return contInfo
 }
@@ -0,0 +1,372 @@
+package crictl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	containersapi "github.com/containerd/containerd/api/services/containers/v1"
+	namespacesapi "github.com/containerd/containerd/api/services/namespaces/v1"
+	tasksapi "github.com/containerd/containerd/api/services/tasks/v1"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const testContainerInfo = `{
+	"sandboxID": "sandbox1",
+	"pid": 1234,
+	"runtimeSpec": {
+		"root": {"path": "rootfs"},
+		"process": {"cwd": "/app", "env": ["PATH=/bin", "KEY=value"], "user": {"uid": 1000, "gid": 2000}},
+		"mounts": [{"destination": "/data", "type": "bind", "source": "/var/lib/kubelet/data"}],
+		"linux": {"namespaces": [{"type": "pid"}, {"type": "network", "path": "/var/run/netns/cni-1"}]}
+	}
+}`
+
+type fakeRuntimeService struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+}
+
+func (f *fakeRuntimeService) ContainerStatus(ctx context.Context, req *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	if req.ContainerId != "cont1" {
+		return nil, status.Errorf(codes.NotFound, "container %s not found", req.ContainerId)
+	}
+	if !req.Verbose {
+		return &runtimeapi.ContainerStatusResponse{Status: &runtimeapi.ContainerStatus{Id: req.ContainerId}}, nil
+	}
+	return &runtimeapi.ContainerStatusResponse{
+		Status: &runtimeapi.ContainerStatus{Id: req.ContainerId},
+		Info:   map[string]string{"info": testContainerInfo},
+	}, nil
+}
+
+func (f *fakeRuntimeService) ListPodSandbox(ctx context.Context, req *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	if req.Filter.LabelSelector[labelPodUID] != "uid1" || req.Filter.State.State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		return &runtimeapi.ListPodSandboxResponse{}, nil
+	}
+	return &runtimeapi.ListPodSandboxResponse{Items: []*runtimeapi.PodSandbox{{Id: "sandbox1"}}}, nil
+}
+
+func (f *fakeRuntimeService) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	return &runtimeapi.PodSandboxStatusResponse{
+		Status: &runtimeapi.PodSandboxStatus{Id: req.PodSandboxId},
+		Info:   map[string]string{"info": `{"pid": 99}`},
+	}, nil
+}
+
+// fakeNamespacesService is fake containerd's namespaces service
+type fakeNamespacesService struct {
+	namespacesapi.UnimplementedNamespacesServer
+}
+
+func (f *fakeNamespacesService) List(ctx context.Context, req *namespacesapi.ListNamespacesRequest) (*namespacesapi.ListNamespacesResponse, error) {
+	return &namespacesapi.ListNamespacesResponse{
+		Namespaces: []namespacesapi.Namespace{{Name: "default"}, {Name: contdNsK8s}},
+	}, nil
+}
+
+// fakeContainersService is fake containerd's containers service. Container cont3 is out of CRI's namespace
+type fakeContainersService struct {
+	containersapi.UnimplementedContainersServer
+}
+
+func (f *fakeContainersService) Get(ctx context.Context, req *containersapi.GetContainerRequest) (*containersapi.GetContainerResponse, error) {
+	if namespace, _ := namespaces.Namespace(ctx); namespace != "default" || req.ID != "cont3" {
+		return nil, errdefs.ToGRPC(errdefs.ErrNotFound)
+	}
+	return &containersapi.GetContainerResponse{
+		Container: containersapi.Container{
+			ID: req.ID,
+			Spec: &types.Any{
+				TypeUrl: "types.containerd.io/opencontainers/runtime-spec/1/Spec",
+				Value:   []byte(`{"root": {"path": "rootfs"}, "process": {"cwd": "/", "env": ["PATH=/bin"]}}`),
+			},
+		},
+	}, nil
+}
+
+// fakeTasksService is fake containerd's tasks service. All containers are stopped
+type fakeTasksService struct {
+	tasksapi.UnimplementedTasksServer
+}
+
+func (f *fakeTasksService) Get(ctx context.Context, req *tasksapi.GetRequest) (*tasksapi.GetResponse, error) {
+	return nil, errdefs.ToGRPC(errdefs.ErrNotFound)
+}
+
+// startFakeRuntime starts fake CRI runtime service and containerd's services on the unix socket
+func startFakeRuntime(t *testing.T) string {
+	socketPath := filepath.Join(t.TempDir(), "cri.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	runtimeapi.RegisterRuntimeServiceServer(server, &fakeRuntimeService{})
+	namespacesapi.RegisterNamespacesServer(server, &fakeNamespacesService{})
+	containersapi.RegisterContainersServer(server, &fakeContainersService{})
+	tasksapi.RegisterTasksServer(server, &fakeTasksService{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return socketPath
+}
+
+func TestGetContainerInfo(t *testing.T) {
+	defer func(path string) { procPath = path }(procPath)
+	procPath = t.TempDir()
+
+	cri, err := New(runtimeContainerd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketPath := startFakeRuntime(t)
+	cri.SetSocketPath(socketPath)
+
+	// State dir of unknown socket is the socket's dir
+	contInfo, err := cri.GetContainerInfo("cont1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPath := filepath.Join(filepath.Dir(socketPath), "io.containerd.runtime.v2.task/k8s.io/cont1/rootfs")
+	if contInfo.PID != 1234 || contInfo.RootPath != rootPath ||
+		contInfo.CWDPath != "/app" || len(contInfo.Envs) != 2 || contInfo.User.UID != 1000 || contInfo.User.GID != 2000 ||
+		len(contInfo.Mounts) != 1 || contInfo.Mounts[0].Destination != "/data" ||
+		len(contInfo.Namespaces) != 2 || contInfo.Namespaces[1].Path != "/var/run/netns/cni-1" {
+		t.Fatalf("container info %+v is not expected", contInfo)
+	}
+
+	// Running task's bundle is a sibling of its shim's bundle
+	writeProcess(t, "100", "/usr/bin/containerd-shim-runc-v2", "-namespace", contdNsK8s, "-id", "sandbox1")
+	writeProcessStat(t, "1234", "1234 (sleep 1) S 100 1234")
+	writeProcessCwd(t, "100", "/data/state/io.containerd.runtime.v2.task/k8s.io/sandbox1")
+	contInfo, err = cri.GetContainerInfo("cont1")
+	if err != nil || contInfo.RootPath != "/data/state/io.containerd.runtime.v2.task/k8s.io/cont1/rootfs" {
+		t.Fatalf("container info %+v is not expected : %v", contInfo, err)
+	}
+
+	// Not found error is typed
+	_, err = cri.GetContainerInfo("cont2")
+	var criErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &criErr) || criErr.ID != "cont2" {
+		t.Fatalf("error %v is not not found error", err)
+	}
+}
+
+func TestGetContainerInfoInNamespaces(t *testing.T) {
+	defer func(path string) { procPath = path }(procPath)
+	procPath = t.TempDir()
+
+	cri, err := New(runtimeContainerd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketPath := startFakeRuntime(t)
+	cri.SetSocketPath(socketPath)
+
+	// Container out of CRI's namespace is searched in containerd's namespaces
+	contInfo, err := cri.GetContainerInfo("cont3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPath := filepath.Join(filepath.Dir(socketPath), "io.containerd.runtime.v2.task/default/cont3/rootfs")
+	if contInfo.PID != 0 || contInfo.RootPath != rootPath || contInfo.CWDPath != "/" {
+		t.Fatalf("container info %+v is not expected", contInfo)
+	}
+
+	// Namespace and state dir set by flags
+	contd := cri.(ContainerdRuntime)
+	contd.SetContainerdNamespace("default")
+	contd.SetContainerdStatePath("/data/state")
+	contInfo, err = cri.GetContainerInfo("cont3")
+	if err != nil || contInfo.RootPath != "/data/state/io.containerd.runtime.v2.task/default/cont3/rootfs" {
+		t.Fatalf("container info %+v is not expected : %v", contInfo, err)
+	}
+	contd.SetContainerdNamespace(contdNsK8s)
+	if _, err := cri.GetContainerInfo("cont3"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("error %v is not not found error", err)
+	}
+}
+
+const testEngineContainer = `{
+	"State": {"Running": true, "Pid": 4321},
+	"GraphDriver": {"Name": "overlay2", "Data": {"MergedDir": "/var/lib/docker/overlay2/abc/merged"}},
+	"Config": {"User": "1000:2000", "Env": ["PATH=/bin"], "WorkingDir": ""},
+	"Mounts": [{"Type": "bind", "Source": "/data", "Destination": "/data", "RW": false}]
+}`
+
+// startFakeEngine starts fake Docker Engine API on the unix socket. Only container cont4 exists
+func startFakeEngine(t *testing.T) string {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/cont4/json" {
+			http.Error(w, `{"message": "No such container"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testEngineContainer))
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socketPath
+}
+
+func TestGetEngineContainerInfo(t *testing.T) {
+	socketPath := startFakeEngine(t)
+
+	contInfo, err := getEngineContainerInfo(socketPath, "cont4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contInfo.PID != 4321 || contInfo.RootPath != "/var/lib/docker/overlay2/abc/merged" || contInfo.CWDPath != "/" ||
+		len(contInfo.Envs) != 1 || contInfo.User.UID != 1000 || contInfo.User.GID != 2000 ||
+		len(contInfo.Mounts) != 1 || contInfo.Mounts[0].Options[1] != "ro" {
+		t.Fatalf("container info %+v is not expected", contInfo)
+	}
+
+	if _, err := getEngineContainerInfo(socketPath, "cont5"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("error %v is not not found error", err)
+	}
+	if _, err := getEngineContainerInfo(filepath.Join(t.TempDir(), "none.sock"), "cont4"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("error %v is not unavailable error", err)
+	}
+}
+
+func TestDockerFallback(t *testing.T) {
+	// Docker runtime is created without containerd
+	cri, err := New(runtimeDocker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docker := cri.(*dockerRuntime)
+	docker.dSocketPath = filepath.Join(t.TempDir(), "none.sock")
+	docker.socketPath = startFakeRuntime(t)
+
+	// Docker Engine API is used if containerd isn't reachable
+	docker.engineSocketPath = startFakeEngine(t)
+	if contInfo, err := cri.GetContainerInfo("cont4"); err != nil || contInfo.PID != 4321 {
+		t.Fatalf("container info %+v is not expected : %v", contInfo, err)
+	}
+	if _, err := cri.GetContainerInfo("cont1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("error %v is not not found error", err)
+	}
+
+	// Docker CRI isn't used if Docker Engine API isn't reachable either
+	docker.engineSocketPath = filepath.Join(t.TempDir(), "none.sock")
+	if _, err := cri.GetContainerInfo("cont1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("error %v is not unavailable error", err)
+	}
+}
+
+func TestDockerSetSocketPath(t *testing.T) {
+	tests := []struct {
+		socketPath string
+		dSocket    bool
+		engine     bool
+		cri        bool
+	}{
+		{"/run/my/containerd.sock", true, false, false},
+		{"/run/my/docker.sock", false, true, false},
+		{"/var/run/cri-dockerd.sock", false, false, true},
+		{"/run/my/dockershim.sock", false, false, true},
+	}
+
+	for _, test := range tests {
+		cri, err := New(runtimeDocker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docker := cri.(*dockerRuntime)
+		docker.SetSocketPath(test.socketPath)
+		if (docker.dSocketPath == test.socketPath) != test.dSocket || (docker.engineSocketPath == test.socketPath) != test.engine ||
+			(docker.socketPath == test.socketPath) != test.cri {
+			t.Fatalf("socket %s is set to docker runtime %+v", test.socketPath, docker)
+		}
+	}
+}
+
+func TestGetSandboxInitPid(t *testing.T) {
+	cri, err := New(runtimeCrio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cri.SetSocketPath(startFakeRuntime(t))
+
+	sandboxID, err := cri.GetSandboxID("uid1")
+	if err != nil || sandboxID != "sandbox1" {
+		t.Fatalf("sandbox ID %s is not expected : %v", sandboxID, err)
+	}
+	if pid, err := cri.GetSandboxInitPid(sandboxID); err != nil || pid != 99 {
+		t.Fatalf("sandbox PID %d is not expected : %v", pid, err)
+	}
+	if _, err := cri.GetSandboxID("uid2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("error %v is not not found error", err)
+	}
+}
+
+func TestUnavailableRuntime(t *testing.T) {
+	cri, err := New(runtimeCrio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cri.SetSocketPath(filepath.Join(t.TempDir(), "none.sock"))
+
+	if _, err := cri.GetContainerInfo("cont1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("error %v is not unavailable error", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if names := Runtimes(); !reflect.DeepEqual(names, []string{runtimeContainerd, runtimeCrio, runtimeDocker, runtimeFake}) {
+		t.Fatalf("registered runtimes %v are not expected", names)
+	}
+	if _, err := New("rkt"); err == nil {
+		t.Fatalf("rkt is not registered")
+	}
+
+	// Registering the same name panics
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("fake runtime is registered twice")
+		}
+	}()
+	Register(runtimeFake, newFake)
+}
+
+func TestFakeRuntime(t *testing.T) {
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+	fixture := `{"containers": {"cont1": {"pid": 10, "cwdPath": "/app",
+		"snapshotMounts": [{"type": "overlay", "source": "overlay", "options": ["lowerdir=/l1:/l2"]}]}}}`
+	if err := os.WriteFile(fixturePath, []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cri, err := New(runtimeFake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cri.SetSocketPath(fixturePath)
+
+	contInfo, err := cri.GetContainerInfo("cont1")
+	if err != nil || contInfo.PID != 10 || contInfo.CWDPath != "/app" {
+		t.Fatalf("container info %+v is not expected : %v", contInfo, err)
+	}
+	mounts, err := cri.GetSnapshotMounts("cont1")
+	if err != nil || len(mounts) != 1 || mounts[0].Options[0] != "lowerdir=/l1:/l2" {
+		t.Fatalf("snapshot mounts %+v are not expected : %v", mounts, err)
+	}
+	if _, err := cri.GetSandboxID("uid1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("error %v is not not found error", err)
+	}
+}
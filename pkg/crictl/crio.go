@@ -0,0 +1,68 @@
+package crictl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	runtimeCrio = "cri-o"
+
+	crioSocketPath = "/var/run/crio/crio.sock"
+)
+
+func init() {
+	Register(runtimeCrio, newCrio)
+}
+
+// crioRuntime gets info through CRI-O's CRI and containers/storage's layers
+type crioRuntime struct {
+	criRuntime
+}
+
+func newCrio() (Runtime, error) {
+	// Use kubelet's container runtime endpoint if it's set
+	socketPath := getKubeletEndpoint()
+	if socketPath == "" {
+		socketPath = crioSocketPath
+	}
+	return &crioRuntime{
+		criRuntime: criRuntime{socketPath: socketPath},
+	}, nil
+}
+
+func (c *crioRuntime) GetSnapshotMounts(contID string) ([]Mount, error) {
+	// Get container's layer from rootfs path (.../overlay/[LAYER ID]/merged)
+	contInfo, err := c.GetContainerInfo(contID)
+	if err != nil {
+		return nil, err
+	}
+	if contInfo.RootPath == "" {
+		return nil, &Error{Op: "get rootfs of container", ID: contID, Err: ErrNoInfo}
+	}
+	layerDirPath := filepath.Dir(contInfo.RootPath)
+
+	// Lower layers are listed as short links relative to overlay dir in the layer's lower file
+	var lowerDirPaths []string
+	lower, err := os.ReadFile(hostRoot + filepath.Join(layerDirPath, "lower"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, link := range strings.Split(strings.TrimSpace(string(lower)), ":") {
+		if link != "" {
+			lowerDirPaths = append(lowerDirPaths, filepath.Join(filepath.Dir(layerDirPath), link))
+		}
+	}
+	return []Mount{
+		{
+			Type:   "overlay",
+			Source: "overlay",
+			Options: []string{
+				"lowerdir=" + strings.Join(lowerDirPaths, ":"),
+				"upperdir=" + filepath.Join(layerDirPath, "diff"),
+				"workdir=" + filepath.Join(layerDirPath, "work"),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,224 @@
+package crictl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kubeletFlagEndpoint = "--container-runtime-endpoint"
+	kubeletFlagConfig   = "--config"
+
+	contdFlagAddress      = "--address"
+	contdFlagAddressShort = "-a"
+	contdFlagConfig       = "--config"
+	contdFlagConfigShort  = "-c"
+	contdFlagState        = "--state"
+	contdConfigPath       = "/etc/containerd/config.toml"
+
+	shimFlagNamespace = "-namespace"
+)
+
+// containerdLocation is a known location of containerd's socket and state dir
+type containerdLocation struct {
+	socketPath string
+	statePath  string
+}
+
+var (
+	// Known locations of containerd. The first is the default location used by kubeadm, kind and managed clusters
+	containerdLocations = []containerdLocation{
+		{contdSocketPath, "/run/containerd"},
+		{"/run/k3s/containerd/containerd.sock", "/run/k3s/containerd"},                                // k3s, RKE2
+		{"/var/snap/microk8s/common/run/containerd.sock", "/var/snap/microk8s/common/run/containerd"}, // MicroK8s
+	}
+
+	// procPath is host's procfs. It's replaced for testing
+	procPath = "/proc"
+)
+
+// kubeletConfig is a part of kubelet's config file
+type kubeletConfig struct {
+	ContainerRuntimeEndpoint string `json:"containerRuntimeEndpoint"`
+}
+
+// containerdConfig is a part of containerd's config file
+type containerdConfig struct {
+	State string `toml:"state"`
+	GRPC  struct {
+		Address string `toml:"address"`
+	} `toml:"grpc"`
+}
+
+// detectContainerdLocation detects containerd's socket and state dir on the host. The socket of kubelet's
+// --container-runtime-endpoint wins, and then known sockets are probed
+func detectContainerdLocation() containerdLocation {
+	if socketPath := getKubeletEndpoint(); socketPath != "" {
+		return getContainerdLocation(socketPath)
+	}
+	for _, location := range containerdLocations {
+		if _, err := os.Stat(hostRoot + location.socketPath); err == nil {
+			return location
+		}
+	}
+	return containerdLocations[0]
+}
+
+// getContainerdLocation gets containerd's location of the socket. Unknown socket's state dir is the socket's dir
+func getContainerdLocation(socketPath string) containerdLocation {
+	for _, location := range containerdLocations {
+		if location.socketPath == socketPath {
+			return location
+		}
+	}
+	return containerdLocation{socketPath: socketPath, statePath: filepath.Dir(socketPath)}
+}
+
+// getKubeletEndpoint gets unix socket path of kubelet's container runtime endpoint from kubelet's
+// command line or config file. If kubelet process isn't found like k3s's embedded kubelet, it returns empty
+func getKubeletEndpoint() string {
+	for _, args := range getProcessArgs("kubelet") {
+		// Flag wins over config file
+		if endpoint := getFlagValue(args, kubeletFlagEndpoint); endpoint != "" {
+			return strings.TrimPrefix(endpoint, "unix://")
+		}
+		configPath := getFlagValue(args, kubeletFlagConfig)
+		if configPath == "" {
+			return ""
+		}
+		data, err := os.ReadFile(hostRoot + configPath)
+		if err != nil {
+			return ""
+		}
+		config := &kubeletConfig{}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return ""
+		}
+		return strings.TrimPrefix(config.ContainerRuntimeEndpoint, "unix://")
+	}
+	return ""
+}
+
+// getContainerdStatePath gets the state dir of containerd serving the socket from containerd's command line or
+// config file. If containerd process isn't found or its state dir isn't set, it returns empty
+func getContainerdStatePath(socketPath string) string {
+	for _, args := range getProcessArgs("containerd") {
+		configPath := getFlagValue(args, contdFlagConfig, contdFlagConfigShort)
+		if configPath == "" {
+			configPath = contdConfigPath
+		}
+		config := &containerdConfig{}
+		if data, err := os.ReadFile(hostRoot + configPath); err == nil {
+			toml.Unmarshal(data, config)
+		}
+
+		// Flags win over config file
+		address := getFlagValue(args, contdFlagAddress, contdFlagAddressShort)
+		if address == "" {
+			address = config.GRPC.Address
+		}
+		if address == "" {
+			address = contdSocketPath
+		}
+		if address != socketPath {
+			continue
+		}
+		if statePath := getFlagValue(args, contdFlagState); statePath != "" {
+			return statePath
+		}
+		return config.State
+	}
+	return ""
+}
+
+// getShimBundlePath gets the bundle path of containerd's shim serving the task of the PID. Shim is the task's
+// parent and runs in the bundle. If the parent isn't a shim, it returns empty
+func getShimBundlePath(pid uint64) string {
+	// Stat is "PID (COMM) STATE PPID ..." and COMM can have spaces
+	stat, err := os.ReadFile(filepath.Join(procPath, strconv.FormatUint(pid, 10), "stat"))
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if len(fields) < 2 {
+		return ""
+	}
+	ppid := fields[1]
+
+	if getFlagValue(readProcessArgs(ppid), shimFlagNamespace) == "" {
+		return ""
+	}
+	bundlePath, err := os.Readlink(filepath.Join(procPath, ppid, "cwd"))
+	if err != nil {
+		return ""
+	}
+	return bundlePath
+}
+
+// getProcessArgs gets command line args of processes whose binary is the name
+func getProcessArgs(name string) [][]string {
+	procDirs, err := os.ReadDir(procPath)
+	if err != nil {
+		return nil
+	}
+	var result [][]string
+	for _, procDir := range procDirs {
+		if _, err := strconv.Atoi(procDir.Name()); err != nil {
+			continue
+		}
+		args := readProcessArgs(procDir.Name())
+		if len(args) > 0 && filepath.Base(args[0]) == name {
+			result = append(result, args)
+		}
+	}
+	return result
+}
+
+// readProcessArgs reads command line args of the process
+func readProcessArgs(pid string) []string {
+	cmdline, err := os.ReadFile(filepath.Join(procPath, pid, "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+}
+
+// getFlagValue gets the value of the flag or its alias from "--flag=value" or "--flag value"
+func getFlagValue(args []string, flags ...string) string {
+	for i, arg := range args {
+		for _, flag := range flags {
+			if strings.HasPrefix(arg, flag+"=") {
+				return strings.TrimPrefix(arg, flag+"=")
+			} else if arg == flag && i+1 < len(args) {
+				return args[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// findSocketPath finds the first socket existing on the host. If no socket exists, it returns the first
+func findSocketPath(socketPaths []string) string {
+	for _, socketPath := range socketPaths {
+		if _, err := os.Stat(hostRoot + socketPath); err == nil {
+			return socketPath
+		}
+	}
+	return socketPaths[0]
+}
+
+// getDialPath gets socket path to dial. If the socket isn't mounted in cnsenter pod, it's dialed through host's root
+func getDialPath(socketPath string) string {
+	if _, err := os.Stat(socketPath); err != nil {
+		if _, err := os.Stat(hostRoot + socketPath); err == nil {
+			return hostRoot + socketPath
+		}
+	}
+	return socketPath
+}
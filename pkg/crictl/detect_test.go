@@ -0,0 +1,136 @@
+package crictl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProcess writes fake process's cmdline to the fake procfs
+func writeProcess(t *testing.T, pid string, args ...string) {
+	dir := filepath.Join(procPath, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmdline := strings.Join(args, "\x00") + "\x00"
+	if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeProcessStat writes fake process's stat to the fake procfs
+func writeProcessStat(t *testing.T, pid, stat string) {
+	dir := filepath.Join(procPath, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeProcessCwd writes fake process's cwd link to the fake procfs
+func writeProcessCwd(t *testing.T, pid, cwd string) {
+	dir := filepath.Join(procPath, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(cwd, filepath.Join(dir, "cwd")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetKubeletEndpoint(t *testing.T) {
+	defer func(path string) { procPath = path }(procPath)
+
+	// No kubelet process like k3s's embedded kubelet
+	procPath = t.TempDir()
+	writeProcess(t, "1", "/sbin/init")
+	writeProcess(t, "10", "/usr/local/bin/k3s", "server")
+	if endpoint := getKubeletEndpoint(); endpoint != "" {
+		t.Fatalf("endpoint %s is not expected", endpoint)
+	}
+
+	// RKE2's kubelet with the flag
+	writeProcess(t, "20", "kubelet", "--v=2", "--container-runtime-endpoint", "unix:///run/k3s/containerd/containerd.sock")
+	if endpoint := getKubeletEndpoint(); endpoint != "/run/k3s/containerd/containerd.sock" {
+		t.Fatalf("endpoint %s is not expected", endpoint)
+	}
+	location := getContainerdLocation(getKubeletEndpoint())
+	if location.statePath != "/run/k3s/containerd" {
+		t.Fatalf("location %+v is not expected", location)
+	}
+}
+
+func TestGetContainerdStatePath(t *testing.T) {
+	defer func(path string) { procPath = path }(procPath)
+
+	// k3s's containerd with the flags and containerd with the default socket
+	procPath = t.TempDir()
+	writeProcess(t, "10", "containerd", "-c", "/none/config.toml", "-a", "/run/k3s/containerd/containerd.sock",
+		"--state", "/run/k3s/containerd")
+	writeProcess(t, "20", "/usr/bin/containerd", "--config=/none/config.toml", "--state=/data/containerd/state")
+	if statePath := getContainerdStatePath("/run/k3s/containerd/containerd.sock"); statePath != "/run/k3s/containerd" {
+		t.Fatalf("state path %s is not expected", statePath)
+	}
+	if statePath := getContainerdStatePath(contdSocketPath); statePath != "/data/containerd/state" {
+		t.Fatalf("state path %s is not expected", statePath)
+	}
+	if statePath := getContainerdStatePath("/run/none.sock"); statePath != "" {
+		t.Fatalf("state path %s is not expected", statePath)
+	}
+}
+
+func TestGetShimBundlePath(t *testing.T) {
+	defer func(path string) { procPath = path }(procPath)
+
+	procPath = t.TempDir()
+	writeProcess(t, "1", "/sbin/init")
+	writeProcess(t, "100", "/usr/bin/containerd-shim-runc-v2", "-namespace", "k8s.io", "-id", "sandbox1")
+	writeProcessCwd(t, "100", "/run/containerd/io.containerd.runtime.v2.task/k8s.io/sandbox1")
+	writeProcessStat(t, "200", "200 (my (app)) S 100 200")
+	writeProcessStat(t, "300", "300 (sh) S 1 300")
+	if bundlePath := getShimBundlePath(200); bundlePath != "/run/containerd/io.containerd.runtime.v2.task/k8s.io/sandbox1" {
+		t.Fatalf("bundle path %s is not expected", bundlePath)
+	}
+
+	// Parent isn't a shim and process doesn't exist
+	if bundlePath := getShimBundlePath(300); bundlePath != "" {
+		t.Fatalf("bundle path %s is not expected", bundlePath)
+	}
+	if bundlePath := getShimBundlePath(400); bundlePath != "" {
+		t.Fatalf("bundle path %s is not expected", bundlePath)
+	}
+}
+
+func TestGetContainerdLocation(t *testing.T) {
+	tests := []struct {
+		socketPath string
+		statePath  string
+	}{
+		{"/run/containerd/containerd.sock", "/run/containerd"},
+		{"/run/k3s/containerd/containerd.sock", "/run/k3s/containerd"},
+		{"/var/snap/microk8s/common/run/containerd.sock", "/var/snap/microk8s/common/run/containerd"},
+		{"/data/containerd/containerd.sock", "/data/containerd"},
+	}
+
+	for _, test := range tests {
+		if location := getContainerdLocation(test.socketPath); location.statePath != test.statePath {
+			t.Fatalf("state path %s of socket %s is not expected", location.statePath, test.socketPath)
+		}
+	}
+}
+
+func TestGetFlagValue(t *testing.T) {
+	args := []string{"kubelet", "--config=/var/lib/kubelet/config.yaml", "--container-runtime-endpoint", "unix:///a.sock"}
+	if value := getFlagValue(args, kubeletFlagConfig); value != "/var/lib/kubelet/config.yaml" {
+		t.Fatalf("value %s is not expected", value)
+	}
+	if value := getFlagValue(args, kubeletFlagEndpoint); value != "unix:///a.sock" {
+		t.Fatalf("value %s is not expected", value)
+	}
+	if value := getFlagValue(args, "--root-dir"); value != "" {
+		t.Fatalf("value %s is not expected", value)
+	}
+}
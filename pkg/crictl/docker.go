@@ -0,0 +1,119 @@
+package crictl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd"
+)
+
+const (
+	runtimeDocker = "docker"
+
+	contdNsDocker         = "moby"
+	dockerContdSocketPath = "/var/run/docker/containerd/containerd.sock"
+	criDockerdSocketPath  = "/var/run/cri-dockerd.sock"
+	dockershimSocketPath  = "/var/run/dockershim.sock"
+)
+
+var (
+	// containerd used by docker. The first is system's containerd and the second is dockerd's managed containerd
+	dockerContdSocketPaths = []string{contdSocketPath, dockerContdSocketPath}
+	// Docker's CRI. cri-dockerd replaces dockershim removed from kubelet
+	dockerCRISocketPaths = []string{criDockerdSocketPath, dockershimSocketPath}
+)
+
+func init() {
+	Register(runtimeDocker, newDocker)
+}
+
+// dockerRuntime gets container's info from containerd and pod sandbox's ID through cri-dockerd or dockershim.
+// Docker CRI doesn't return PID, CWD and Env info, so we use containerd client directly instead of CRI.
+// If containerd isn't reachable or doesn't have the container, Docker Engine API is used.
+type dockerRuntime struct {
+	criRuntime
+	contdSettings
+
+	dSocketPath      string
+	engineSocketPath string
+}
+
+func newDocker() (Runtime, error) {
+	// Use kubelet's container runtime endpoint if it's set like cri-dockerd
+	criSocketPath := getKubeletEndpoint()
+	if criSocketPath == "" {
+		criSocketPath = findSocketPath(dockerCRISocketPaths)
+	}
+	return &dockerRuntime{
+		criRuntime:       criRuntime{socketPath: criSocketPath},
+		contdSettings:    contdSettings{namespace: contdNsDocker},
+		dSocketPath:      findSocketPath(dockerContdSocketPaths),
+		engineSocketPath: dockerEngineSocketPath,
+	}, nil
+}
+
+func (d *dockerRuntime) SetSocketPath(socketPath string) error {
+	// Socket can be containerd's, Docker Engine's or Docker CRI's. They speak different APIs, so the socket
+	// replaces only the path of its kind by the socket's name
+	switch filepath.Base(socketPath) {
+	case filepath.Base(dockerContdSocketPath):
+		d.dSocketPath = socketPath
+	case filepath.Base(dockerEngineSocketPath):
+		d.engineSocketPath = socketPath
+	default:
+		d.socketPath = socketPath
+	}
+	return nil
+}
+
+func (d *dockerRuntime) GetContainerInfo(contID string) (*ContainerInfo, error) {
+	contInfo, err := d.getContdContainerInfo(contID)
+	if err == nil {
+		return contInfo, nil
+	}
+
+	// Stopped container is removed from containerd, so Docker Engine API is used even if it's not found.
+	// Docker CRI's verbose status doesn't have container's info, so it isn't used
+	return getEngineContainerInfo(d.engineSocketPath, contID)
+}
+
+func (d *dockerRuntime) GetSandboxInitPid(sandboxID string) (uint64, error) {
+	// Sandbox is pause container, so get PID from containerd
+	contInfo, err := d.GetContainerInfo(sandboxID)
+	if err != nil {
+		return 0, err
+	}
+	if contInfo.PID == 0 {
+		return 0, &Error{Op: "get task of pod sandbox", ID: sandboxID, Err: ErrNotFound}
+	}
+	return contInfo.PID, nil
+}
+
+func (d *dockerRuntime) GetSnapshotMounts(contID string) ([]Mount, error) {
+	// Docker's image layers aren't managed by containerd
+	return nil, fmt.Errorf("snapshot of docker container is not supported")
+}
+
+// getContdContainerInfo gets container's info from containerd's task and spec
+func (d *dockerRuntime) getContdContainerInfo(contID string) (*ContainerInfo, error) {
+	// containerd's dialer waits for the socket to be created until timeout, so check the socket first
+	dialPath := getDialPath(d.dSocketPath)
+	if _, err := os.Stat(dialPath); err != nil {
+		return nil, &Error{Op: "connect containerd for container", ID: contID, Err: fmt.Errorf("%w : %v", ErrUnavailable, err)}
+	}
+	client, err := containerd.New(dialPath)
+	if err != nil {
+		return nil, &Error{Op: "connect containerd for container", ID: contID, Err: fmt.Errorf("%w : %v", ErrUnavailable, err)}
+	}
+	defer client.Close()
+
+	contInfo, namespace, err := getContdContainerInfo(client, d.namespace, contID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Docker sets absolute rootfs path of its graph driver, so the bundle is rarely needed
+	d.resolveRootPath(contInfo, d.dSocketPath, getContainerdLocation(d.dSocketPath).statePath, namespace, contID)
+	return contInfo, nil
+}
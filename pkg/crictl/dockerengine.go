@@ -0,0 +1,106 @@
+package crictl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	dockerEngineSocketPath = "/var/run/docker.sock"
+)
+
+// engineContainer is a part of the container inspected through Docker Engine API
+type engineContainer struct {
+	State struct {
+		Pid uint64 `json:"Pid"`
+	} `json:"State"`
+	GraphDriver struct {
+		Data map[string]string `json:"Data"`
+	} `json:"GraphDriver"`
+	Config struct {
+		User       string   `json:"User"`
+		Env        []string `json:"Env"`
+		WorkingDir string   `json:"WorkingDir"`
+	} `json:"Config"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+}
+
+// getEngineContainerInfo gets container's info by inspecting the container through Docker Engine API.
+// Rootfs is the graph driver's merged dir and stopped container's PID is 0
+func getEngineContainerInfo(socketPath, contID string) (*ContainerInfo, error) {
+	dialPath := getDialPath(socketPath)
+	client := &http.Client{
+		Timeout: criTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", dialPath)
+			},
+		},
+	}
+	resp, err := client.Get("http://docker/containers/" + url.PathEscape(contID) + "/json")
+	if err != nil {
+		return nil, &Error{Op: "inspect container", ID: contID, Err: fmt.Errorf("%w : %v", ErrUnavailable, err)}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, &Error{Op: "inspect container", ID: contID, Err: ErrNotFound}
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &Error{Op: "inspect container", ID: contID, Err: fmt.Errorf("docker engine returns %s : %s", resp.Status, strings.TrimSpace(string(body)))}
+	}
+	cont := &engineContainer{}
+	if err := json.NewDecoder(resp.Body).Decode(cont); err != nil {
+		return nil, &Error{Op: "inspect container", ID: contID, Err: fmt.Errorf("failed to parse inspected container : %+v", err)}
+	}
+
+	contInfo := &ContainerInfo{
+		PID:      cont.State.Pid,
+		RootPath: cont.GraphDriver.Data["MergedDir"],
+		CWDPath:  cont.Config.WorkingDir,
+		Envs:     cont.Config.Env,
+		User:     parseEngineUser(cont.Config.User),
+	}
+	if contInfo.CWDPath == "" {
+		contInfo.CWDPath = "/"
+	}
+	for _, m := range cont.Mounts {
+		options := []string{"rbind", "ro"}
+		if m.RW {
+			options[1] = "rw"
+		}
+		contInfo.Mounts = append(contInfo.Mounts, specs.Mount{Destination: m.Destination, Type: "bind", Source: m.Source, Options: options})
+	}
+	return contInfo, nil
+}
+
+// parseEngineUser parses "UID[:GID]" user of the container's config. User name isn't resolved
+func parseEngineUser(user string) specs.User {
+	result := specs.User{}
+	ids := strings.SplitN(user, ":", 2)
+	if id, err := strconv.ParseUint(ids[0], 10, 32); err == nil {
+		result.UID = uint32(id)
+	}
+	if len(ids) == 2 {
+		if id, err := strconv.ParseUint(ids[1], 10, 32); err == nil {
+			result.GID = uint32(id)
+		}
+	}
+	return result
+}
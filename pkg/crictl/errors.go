@@ -0,0 +1,45 @@
+package crictl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containerd/containerd/errdefs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotFound is returned if the container or pod sandbox doesn't exist in the runtime
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is returned if the runtime can't be connected through the socket
+	ErrUnavailable = errors.New("runtime is unavailable")
+	// ErrNoInfo is returned if the runtime doesn't return the info needed in verbose status
+	ErrNoInfo = errors.New("no verbose info")
+)
+
+// Error is an error of the request about the container or pod sandbox to the runtime
+type Error struct {
+	Op  string
+	ID  string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("failed to %s %s : %+v", e.Op, e.ID, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps gRPC and containerd errors with ErrNotFound or ErrUnavailable
+func newError(op, id string, err error) error {
+	switch {
+	case status.Code(err) == codes.NotFound, errdefs.IsNotFound(err):
+		err = fmt.Errorf("%w : %s", ErrNotFound, status.Convert(err).Message())
+	case status.Code(err) == codes.Unavailable, errdefs.IsUnavailable(err):
+		err = fmt.Errorf("%w : %s", ErrUnavailable, status.Convert(err).Message())
+	}
+	return &Error{Op: op, ID: id, Err: err}
+}
@@ -0,0 +1,110 @@
+package crictl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	runtimeFake = "fake"
+)
+
+func init() {
+	Register(runtimeFake, newFake)
+}
+
+// fakeFixture is fake runtime's fixture. Sandboxes are indexed by pod UID
+type fakeFixture struct {
+	Containers map[string]fakeContainer `json:"containers"`
+	Sandboxes  map[string]fakeSandbox   `json:"sandboxes"`
+}
+
+type fakeContainer struct {
+	ContainerInfo
+	SnapshotMounts []Mount `json:"snapshotMounts"`
+}
+
+type fakeSandbox struct {
+	ID  string `json:"id"`
+	PID uint64 `json:"pid"`
+}
+
+// fakeRuntime returns info from fixture JSON file set as socket path. It's for testing cnsenter without runtimes
+type fakeRuntime struct {
+	fixturePath string
+}
+
+func newFake() (Runtime, error) {
+	return &fakeRuntime{}, nil
+}
+
+func (f *fakeRuntime) SetSocketPath(socketPath string) error {
+	f.fixturePath = socketPath
+	return nil
+}
+
+func (f *fakeRuntime) GetContainerInfo(contID string) (*ContainerInfo, error) {
+	fixture, err := f.loadFixture()
+	if err != nil {
+		return nil, err
+	}
+	cont, ok := fixture.Containers[contID]
+	if !ok {
+		return nil, &Error{Op: "get status of container", ID: contID, Err: ErrNotFound}
+	}
+	return &cont.ContainerInfo, nil
+}
+
+func (f *fakeRuntime) GetSandboxID(podUID string) (string, error) {
+	fixture, err := f.loadFixture()
+	if err != nil {
+		return "", err
+	}
+	sandbox, ok := fixture.Sandboxes[podUID]
+	if !ok {
+		return "", &Error{Op: "get ready pod sandbox of pod", ID: podUID, Err: ErrNotFound}
+	}
+	return sandbox.ID, nil
+}
+
+func (f *fakeRuntime) GetSandboxInitPid(sandboxID string) (uint64, error) {
+	fixture, err := f.loadFixture()
+	if err != nil {
+		return 0, err
+	}
+	for _, sandbox := range fixture.Sandboxes {
+		if sandbox.ID == sandboxID {
+			return sandbox.PID, nil
+		}
+	}
+	return 0, &Error{Op: "get status of pod sandbox", ID: sandboxID, Err: ErrNotFound}
+}
+
+func (f *fakeRuntime) GetSnapshotMounts(contID string) ([]Mount, error) {
+	fixture, err := f.loadFixture()
+	if err != nil {
+		return nil, err
+	}
+	cont, ok := fixture.Containers[contID]
+	if !ok {
+		return nil, &Error{Op: "get snapshot mounts of container", ID: contID, Err: ErrNotFound}
+	}
+	return cont.SnapshotMounts, nil
+}
+
+// loadFixture loads fixture on every call, so the fixture can be changed while testing
+func (f *fakeRuntime) loadFixture() (*fakeFixture, error) {
+	if f.fixturePath == "" {
+		return nil, fmt.Errorf("fixture of fake runtime must be set as socket path")
+	}
+	data, err := os.ReadFile(f.fixturePath)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &fakeFixture{}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture : %+v", err)
+	}
+	return fixture, nil
+}